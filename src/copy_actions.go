@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Max copy actions in server submenu
+const copySlots = 10
+
+// Named copy template, shown in server submenu
+type copyAction struct {
+	Name string `json:"name"`
+	Mask string `json:"mask"`
+	// Action for click on server item
+	Default bool `json:"default,omitempty"`
+	// Escape values: shell, url, json or empty
+	Escape string `json:"escape,omitempty"`
+}
+
+func defaultCopyActions() []*copyAction {
+	return []*copyAction{
+		{Name: "SSH", Mask: "ssh root@{IPv4}", Default: true, Escape: escapeShell},
+		{Name: "IP", Mask: "{IPvX}"},
+		{Name: "ID", Mask: "{ID}"},
+	}
+}
+
+// Index of default action, first if not marked, -1 if no actions
+func (d *settingsData) defaultCopyAction() int {
+	for idx, action := range d.CopyActions {
+		if action.Default {
+			return idx
+		}
+	}
+	if len(d.CopyActions) > 0 {
+		return 0
+	}
+	return -1
+}
+
+// Titles for server submenu
+func (d *settingsData) copyActionNames() []string {
+	result := make([]string, len(d.CopyActions))
+	for idx, action := range d.CopyActions {
+		result[idx] = "Copy " + action.Name
+	}
+	return result
+}
+
+// Move old copy_mask into the first action
+func (d *settingsData) migrateCopyMask() {
+	if d.CopyActions == nil {
+		d.CopyActions = defaultCopyActions()
+		// old mask may have own quotes
+		if d.CopyMask != "" {
+			d.CopyActions[0].Mask = d.CopyMask
+			d.CopyActions[0].Escape = escapeNone
+		}
+	}
+	d.CopyMask = ""
+}
+
+func validateCopyActions(actions []*copyAction) error {
+	if len(actions) > copySlots {
+		return fmt.Errorf("No more than %d actions", copySlots)
+	}
+	defaults := 0
+	for idx, action := range actions {
+		if action == nil || strings.TrimSpace(action.Name) == "" {
+			return fmt.Errorf("Action %d: empty name", idx+1)
+		}
+		if err := validateMask(action.Mask, false); err != nil {
+			return fmt.Errorf("Action %s: %v", action.Name, err)
+		}
+		if _, ok := escapeModes[action.Escape]; !ok && action.Escape != escapeNone {
+			return fmt.Errorf("Action %s: wrong escape %q", action.Name, action.Escape)
+		}
+		if action.Escape != escapeNone && isTemplateMask(action.Mask) {
+			return fmt.Errorf("Action %s: %v", action.Name, errTemplateEscape)
+		}
+		if action.Default {
+			defaults++
+		}
+	}
+	if defaults > 1 {
+		return fmt.Errorf("Only one action can be default")
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// Resolve name and compare with server addresses. Return error on failure or mismatch
+func checkDNS(name, resolver string, expected []string, timeout time.Duration) error {
+	r := net.DefaultResolver
+	if resolver != "" {
+		if _, _, err := net.SplitHostPort(resolver); err != nil {
+			resolver = net.JoinHostPort(resolver, "53")
+		}
+		r = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				d := net.Dialer{}
+				return d.DialContext(ctx, network, resolver)
+			},
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	answers, err := r.LookupIPAddr(ctx, name)
+	if err != nil {
+		return err
+	}
+	resolved := make([]string, len(answers))
+	for idx, answer := range answers {
+		resolved[idx] = answer.IP.String()
+	}
+	for _, ip := range resolved {
+		if indexOf(expected, ip) < 0 {
+			return fmt.Errorf("%s resolves to %s, expected %s", name, strings.Join(resolved, ", "), strings.Join(expected, ", "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Formats for {AGE}, {MODIFIED} and {SINCE}
+const (
+	// 3d 4h
+	durationShort = "short"
+	// 3 days 4 hours
+	durationLong = "long"
+	// 76h
+	durationHours = "hours"
+	// 3d
+	durationDays = "days"
+)
+
+var durationFormats = []string{durationShort, durationLong, durationHours, durationDays}
+
+// Set by scaleway worker from settings, templates haven't access to settings
+var durationFormat = struct {
+	format string
+	L      sync.RWMutex
+}{format: durationShort}
+
+func setDurationFormat(format string) {
+	durationFormat.L.Lock()
+	durationFormat.format = format
+	durationFormat.L.Unlock()
+}
+
+func getDurationFormat() string {
+	durationFormat.L.RLock()
+	defer durationFormat.L.RUnlock()
+	return durationFormat.format
+}
+
+var durationUnits = []struct {
+	short string
+	long  string
+	value time.Duration
+}{
+	{"d", "day", time.Hour * 24},
+	{"h", "hour", time.Hour},
+	{"m", "minute", time.Minute},
+	{"s", "second", time.Second},
+}
+
+// Time since, empty for zero time
+func formatSince(value time.Time, format string) string {
+	if value.IsZero() {
+		return ""
+	}
+	return formatDuration(time.Since(value), format)
+}
+
+// Largest unit and next one for short and long
+func formatDuration(value time.Duration, format string) string {
+	if value < 0 {
+		value = 0
+	}
+	switch format {
+	case durationHours:
+		return fmt.Sprintf("%dh", value/time.Hour)
+	case durationDays:
+		return fmt.Sprintf("%dd", value/(time.Hour*24))
+	}
+	parts := []string{}
+	for idx, unit := range durationUnits {
+		count := value / unit.value
+		value -= count * unit.value
+		if count == 0 && unit.value != time.Second {
+			continue
+		}
+		parts = append(parts, formatUnit(count, unit.short, unit.long, format))
+		// next unit if not zero
+		if idx+1 < len(durationUnits) {
+			next := durationUnits[idx+1]
+			if count = value / next.value; count > 0 {
+				parts = append(parts, formatUnit(count, next.short, next.long, format))
+			}
+		}
+		break
+	}
+	return strings.Join(parts, " ")
+}
+
+func formatUnit(count time.Duration, short, long, format string) string {
+	if format != durationLong {
+		return fmt.Sprintf("%d%s", count, short)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d %s", count, long)
+	}
+	return fmt.Sprintf("%d %ss", count, long)
+}
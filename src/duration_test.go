@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatDuration(t *testing.T) {
+	const day = time.Hour * 24
+	tests := []struct {
+		value  time.Duration
+		format string
+		want   string
+	}{
+		{0, durationShort, "0s"},
+		{-time.Minute, durationShort, "0s"},
+		{time.Second * 42, durationShort, "42s"},
+		{time.Minute*5 + time.Second*3, durationShort, "5m 3s"},
+		{time.Hour, durationShort, "1h"},
+		{time.Hour*2 + time.Second*59, durationShort, "2h"},
+		{day*3 + time.Hour*4 + time.Minute*5, durationShort, "3d 4h"},
+		// next unit is zero, smaller units are dropped
+		{day*3 + time.Minute*5, durationShort, "3d"},
+		{day*3 + time.Minute*5, durationLong, "3 days"},
+		{day + time.Hour, durationLong, "1 day 1 hour"},
+		{day*2 + time.Hour*5, durationLong, "2 days 5 hours"},
+		{time.Minute + time.Second*2, durationLong, "1 minute 2 seconds"},
+		{day*3 + time.Hour*4, durationHours, "76h"},
+		{time.Minute * 59, durationHours, "0h"},
+		{day*3 + time.Hour*23, durationDays, "3d"},
+		{day*3 + time.Hour*4, "", "3d 4h"},
+	}
+	for _, test := range tests {
+		if result := formatDuration(test.value, test.format); result != test.want {
+			t.Errorf("formatDuration(%v, %q) = %q, want %q", test.value, test.format, result, test.want)
+		}
+	}
+}
+
+func TestExecuteMaskStyleDuration(t *testing.T) {
+	item := &serverInfo{created: time.Now().Add(-(time.Hour*24*3 + time.Hour*4 + time.Minute))}
+	for mask, want := range map[string]string{
+		"{AGE}":            "76h",
+		"{{.AGE}}":         "76h",
+		"{{ago .Created}}": "76h",
+	} {
+		result, err := executeMaskStyle(mask, item, false, escapeNone, &maskStyle{duration: durationHours})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result != want {
+			t.Errorf("mask %q: got %q, want %q", mask, result, want)
+		}
+	}
+	// explicit style doesn't change cached template
+	if result, _ := executeMask("{{ago .Created}}", item, false, escapeNone); result != formatSince(item.created, getDurationFormat()) {
+		t.Errorf("active style: got %q", result)
+	}
+}
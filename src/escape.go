@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Escape modes for copy actions
+const (
+	escapeNone  = ""
+	escapeShell = "shell"
+	escapeURL   = "url"
+	escapeJSON  = "json"
+)
+
+var escapeModes = map[string]func(string) string{
+	escapeShell: shellQuote,
+	escapeURL:   urlEscape,
+	escapeJSON:  jsonEscape,
+}
+
+var shellSafeRe = regexp.MustCompile(`^[A-Za-z0-9@%+=:,./_-]+$`)
+
+// Single quotes unless value is safe as is, e.g. IP
+func shellQuote(value string) string {
+	if shellSafeRe.MatchString(value) {
+		return value
+	}
+	return "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+}
+
+// Safe for path and query
+func urlEscape(value string) string {
+	return strings.Replace(url.QueryEscape(value), "+", "%20", -1)
+}
+
+// Content of JSON string, without quotes
+func jsonEscape(value string) string {
+	result, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	return string(result[1 : len(result)-1])
+}
+
+// Escape function of mode, unknown mode keeps values
+func escapeFunc(mode string) func(string) string {
+	if escape, ok := escapeModes[mode]; ok {
+		return escape
+	}
+	return func(value string) string {
+		return value
+	}
+}
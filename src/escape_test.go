@@ -0,0 +1,164 @@
+package main
+
+import (
+	"os/exec"
+	"runtime"
+	"testing"
+)
+
+var hostileNames = []string{
+	"a b",
+	"$(rm -rf ~)",
+	"`id`",
+	"it's",
+	"line\nbreak",
+	"semi;colon && x | y > z",
+	"",
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		value, want string
+	}{
+		{"192.0.2.1", "192.0.2.1"},
+		{"2001:db8::1", "2001:db8::1"},
+		{"web-1", "web-1"},
+		{"a b", "'a b'"},
+		{"$(rm -rf ~)", "'$(rm -rf ~)'"},
+		{"it's", `'it'\''s'`},
+		{"line\nbreak", "'line\nbreak'"},
+		{"", "''"},
+	}
+	for _, test := range tests {
+		if result := shellQuote(test.value); result != test.want {
+			t.Errorf("shellQuote(%q) = %q, want %q", test.value, result, test.want)
+		}
+	}
+}
+
+// Shell must get back the same value
+func TestShellQuoteRoundTrip(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no sh")
+	}
+	for _, value := range hostileNames {
+		output, err := exec.Command("sh", "-c", "printf %s "+shellQuote(value)).Output()
+		if err != nil {
+			t.Fatalf("sh for %q: %v", value, err)
+		}
+		if string(output) != value {
+			t.Errorf("sh got %q, want %q", output, value)
+		}
+	}
+}
+
+func TestURLEscape(t *testing.T) {
+	tests := []struct {
+		value, want string
+	}{
+		{"web-1", "web-1"},
+		{"a b", "a%20b"},
+		{"a+b&c=d/e?f#g", "a%2Bb%26c%3Dd%2Fe%3Ff%23g"},
+		{"$(rm -rf ~)", "%24%28rm%20-rf%20~%29"},
+		{"line\nbreak", "line%0Abreak"},
+	}
+	for _, test := range tests {
+		if result := urlEscape(test.value); result != test.want {
+			t.Errorf("urlEscape(%q) = %q, want %q", test.value, result, test.want)
+		}
+	}
+}
+
+func TestJSONEscape(t *testing.T) {
+	tests := []struct {
+		value, want string
+	}{
+		{"web-1", "web-1"},
+		{`say "hi"`, `say \"hi\"`},
+		{`back\slash`, `back\\slash`},
+		{"line\nbreak", `line\nbreak`},
+		{"tab\tx", `tab\tx`},
+	}
+	for _, test := range tests {
+		if result := jsonEscape(test.value); result != test.want {
+			t.Errorf("jsonEscape(%q) = %q, want %q", test.value, result, test.want)
+		}
+	}
+}
+
+func TestExecuteMaskEscapeShell(t *testing.T) {
+	for _, name := range hostileNames {
+		item := &serverInfo{NAME: name, IPv4: "192.0.2.1", isIPv4: true}
+		result, err := executeMask("ssh root@{IPv4} # {NAME}", item, false, escapeShell)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "ssh root@192.0.2.1 # " + shellQuote(name); result != want {
+			t.Errorf("name %q: got %q, want %q", name, result, want)
+		}
+	}
+
+	tags := []string{"key=$(x)", "it's"}
+	item := &serverInfo{NAME: "web", tags: tags, tagMap: parseTags(tags)}
+	for mask, want := range map[string]string{
+		"{TAG:key}":           "'$(x)'",
+		"{TAG:missing|$(y)}":  "'$(y)'",
+		"{HAS_TAG:it's}":      `'it'\''s'`,
+		"echo {TAG:key} done": "echo '$(x)' done",
+	} {
+		result, err := executeMask(mask, item, false, escapeShell)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result != want {
+			t.Errorf("mask %q: got %q, want %q", mask, result, want)
+		}
+	}
+}
+
+func TestExecuteMaskTemplateEscape(t *testing.T) {
+	item := &serverInfo{NAME: "it's $(x)"}
+	result, err := executeMask("{{shell .NAME}}", item, false, escapeNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := shellQuote(item.NAME); result != want {
+		t.Errorf("got %q, want %q", result, want)
+	}
+	// no double quoting: escape mode isn't allowed for templates
+	if _, err = executeMask("{{shell .NAME}}", item, false, escapeShell); err != errTemplateEscape {
+		t.Errorf("got %v, want %v", err, errTemplateEscape)
+	}
+}
+
+// Rule template for default SSH action must not fail on its shell escape
+func TestCopyMaskRuleEscape(t *testing.T) {
+	rules := maskRules{
+		{Tag: "bastion", CopyMask: "ssh -J bastion root@{{shell .NAME}}"},
+		{Tag: "legacy", CopyMask: "ssh root@{NAME}"},
+	}
+	action := defaultCopyActions()[0]
+	tests := []struct {
+		tag       string
+		isDefault bool
+		want      string
+	}{
+		{"bastion", true, "ssh -J bastion root@'it'\\''s $(x)'"},
+		{"legacy", true, "ssh root@'it'\\''s $(x)'"},
+		{"bastion", false, ""},
+	}
+	for _, test := range tests {
+		item := &serverInfo{NAME: "it's $(x)", IPv4: "192.0.2.1", isIPv4: true, tags: []string{test.tag}}
+		mask, escape := rules.CopyMask(action.Mask, action.Escape, test.isDefault, item)
+		result, err := fillCopy(mask, item, escape)
+		if err != nil {
+			t.Fatalf("tag %s: %v", test.tag, err)
+		}
+		if test.want == "" {
+			test.want, _ = fillCopy(action.Mask, item, action.Escape)
+		}
+		if result != test.want {
+			t.Errorf("tag %s, default %v: got %q, want %q", test.tag, test.isDefault, result, test.want)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Nagios plugin exit codes
+const (
+	checkOK = iota
+	checkWarning
+	checkCritical
+	checkUnknown
+)
+
+var checkStatusNames = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+// External command as probe, Nagios plugin conventions
+type externalCheck struct {
+	Name string `json:"name"`
+	// Template, e.g. check_http -H {IPv4}. Not run via shell
+	Command string `json:"command"`
+	// In sec, 0 for 10
+	Timeout int `json:"timeout"`
+	// Only for servers with tag, empty for all
+	Tag string `json:"tag"`
+}
+
+type checkResult struct {
+	Status int
+	// First output line before |
+	Output string
+	// Performance data after |
+	Perf string
+}
+
+func (c checkResult) StatusName() string {
+	if c.Status < 0 || c.Status >= len(checkStatusNames) {
+		return checkStatusNames[checkUnknown]
+	}
+	return checkStatusNames[c.Status]
+}
+
+// Limit running commands
+type limiter struct {
+	L     sync.Mutex
+	cond  *sync.Cond
+	limit int
+	used  int
+}
+
+func newLimiter(limit int) *limiter {
+	l := &limiter{limit: limit}
+	l.cond = sync.NewCond(&l.L)
+	return l
+}
+
+func (l *limiter) Acquire() {
+	l.L.Lock()
+	defer l.L.Unlock()
+	for l.used >= l.limit {
+		l.cond.Wait()
+	}
+	l.used++
+}
+
+func (l *limiter) Release() {
+	l.L.Lock()
+	defer l.L.Unlock()
+	l.used--
+	l.cond.Broadcast()
+}
+
+func (l *limiter) SetLimit(limit int) {
+	if limit < 1 {
+		limit = 1
+	}
+	l.L.Lock()
+	defer l.L.Unlock()
+	l.limit = limit
+	l.cond.Broadcast()
+}
+
+var externalLimiter = newLimiter(4)
+
+// Wait for output after exit, children may hold stdout
+const externalWaitDelay = time.Second
+
+// Run prepared command args
+func runExternalCheck(args []string, timeout time.Duration) checkResult {
+	if len(args) == 0 {
+		return checkResult{Status: checkUnknown, Output: "Empty command"}
+	}
+	externalLimiter.Acquire()
+	defer externalLimiter.Release()
+
+	// stdout is a file, so Wait doesn't wait for children holding it
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return checkResult{Status: checkUnknown, Output: err.Error()}
+	}
+	defer reader.Close()
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout = writer
+	setProcessGroup(cmd)
+	err = cmd.Start()
+	writer.Close()
+	if err != nil {
+		return checkResult{Status: checkUnknown, Output: err.Error()}
+	}
+	outputChan := make(chan []byte, 1)
+	go func() {
+		output, _ := ioutil.ReadAll(reader)
+		outputChan <- output
+	}()
+	waitChan := make(chan error, 1)
+	go func() {
+		waitChan <- cmd.Wait()
+	}()
+
+	timedOut := false
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err = <-waitChan:
+	case <-timer.C:
+		timedOut = true
+		killProcessGroup(cmd)
+		err = <-waitChan
+	}
+	var output []byte
+	select {
+	case output = <-outputChan:
+	case <-time.After(externalWaitDelay):
+	}
+
+	result := parseCheckOutput(output)
+	result.Status = checkOK
+	if timedOut {
+		result.Status = checkUnknown
+		result.Output = fmt.Sprintf("Timeout after %v", timeout)
+	} else if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			result.Status = checkUnknown
+			if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+				result.Status = status.ExitStatus()
+			}
+			if result.Status < checkOK || result.Status > checkUnknown {
+				result.Status = checkUnknown
+			}
+		} else {
+			result.Status = checkUnknown
+			result.Output = err.Error()
+		}
+	}
+	return result
+}
+
+func parseCheckOutput(output []byte) checkResult {
+	result := checkResult{}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	if scanner.Scan() {
+		line := scanner.Text()
+		if idx := strings.Index(line, "|"); idx >= 0 {
+			result.Perf = strings.TrimSpace(line[idx+1:])
+			line = line[:idx]
+		}
+		result.Output = strings.TrimSpace(line)
+	}
+	return result
+}
+
+// Split command line to args, with single and double quotes. Args are filled separately, so values can't break command
+func prepareCommand(command string, data *serverInfo) []string {
+	args := []string{}
+	current := strings.Builder{}
+	var quote rune
+	inArg := false
+	for _, r := range command {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			current.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, fillMask(current.String(), data))
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, fillMask(current.String(), data))
+	}
+	return args
+}
@@ -0,0 +1,13 @@
+//go:build windows
+// +build windows
+
+package main
+
+import "os/exec"
+
+// Windows has no process groups for kill, output of children is dropped after externalWaitDelay
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Limit for body reading
+const httpMaxBody = 1024 * 1024
+
+type httpCheck struct {
+	// Template, e.g. https://{HOSTNAME}/healthz
+	URL string `json:"url"`
+	// Expected status code, 0 for 200
+	Status    int    `json:"status"`
+	BodyRegex string `json:"body_regex"`
+	// In sec, 0 for 5
+	Timeout  int  `json:"timeout"`
+	Insecure bool `json:"insecure"`
+
+	// compiled once, checks are replaced when settings change
+	bodyOnce sync.Once
+	bodyRe   *regexp.Regexp
+	bodyErr  error
+}
+
+// Shared by all checks, so keep-alive connections are reused instead of leaking
+var httpTransports = map[bool]*http.Transport{
+	false: newHTTPTransport(nil),
+	true:  newHTTPTransport(&tls.Config{InsecureSkipVerify: true}),
+}
+
+// Like http.DefaultTransport: proxy from environment and dial timeouts
+func newHTTPTransport(tlsConfig *tls.Config) *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   1,
+		IdleConnTimeout:       time.Minute,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+		TLSClientConfig:       tlsConfig,
+	}
+}
+
+func (c *httpCheck) bodyRegexp() (*regexp.Regexp, error) {
+	c.bodyOnce.Do(func() {
+		c.bodyRe, c.bodyErr = regexp.Compile(c.BodyRegex)
+	})
+	return c.bodyRe, c.bodyErr
+}
+
+// Run check, return result and request time
+func checkHTTP(check *httpCheck, url string) (bool, time.Duration) {
+	timeout := time.Second * 5
+	if check.Timeout > 0 {
+		timeout = time.Second * time.Duration(check.Timeout)
+	}
+	client := &http.Client{
+		Timeout:   timeout,
+		Transport: httpTransports[check.Insecure],
+	}
+	start := time.Now()
+	response, err := client.Get(url)
+	if err != nil {
+		printErr("HTTP check %s: %v", url, err)
+		return false, 0
+	}
+	defer response.Body.Close()
+	expected := check.Status
+	if expected == 0 {
+		expected = http.StatusOK
+	}
+	if response.StatusCode != expected {
+		_, _ = io.Copy(ioutil.Discard, io.LimitReader(response.Body, httpMaxBody))
+		return false, time.Since(start)
+	}
+	if check.BodyRegex == "" {
+		return true, time.Since(start)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(response.Body, httpMaxBody))
+	rtt := time.Since(start)
+	if err != nil {
+		printErr("HTTP check %s: %v", url, err)
+		return false, rtt
+	}
+	re, err := check.bodyRegexp()
+	if err != nil {
+		printErr("HTTP check regexp %s: %v", check.BodyRegex, err)
+		return false, rtt
+	}
+	return re.Match(body), rtt
+}
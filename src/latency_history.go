@@ -0,0 +1,109 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Probes in history
+const historySize = 20
+
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+const sparkLost = '·'
+
+// Ring buffer of recent probe results
+type latencyHistory struct {
+	// negative for lost probe
+	samples [historySize]time.Duration
+	pos     int
+	count   int
+}
+
+func (h *latencyHistory) Add(rtt time.Duration, ok bool) {
+	if !ok {
+		rtt = -1
+	}
+	h.samples[h.pos] = rtt
+	h.pos = (h.pos + 1) % historySize
+	if h.count < historySize {
+		h.count++
+	}
+}
+
+// From oldest to newest
+func (h *latencyHistory) values() []time.Duration {
+	result := make([]time.Duration, 0, h.count)
+	start := (h.pos - h.count + historySize) % historySize
+	for idx := 0; idx < h.count; idx++ {
+		result = append(result, h.samples[(start+idx)%historySize])
+	}
+	return result
+}
+
+// Only successful probes
+func (h *latencyHistory) successful() []time.Duration {
+	result := []time.Duration{}
+	for _, value := range h.values() {
+		if value >= 0 {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// Spark unicode sparkline, e.g. ▁▂▅▇
+func (h *latencyHistory) Spark() string {
+	values := h.values()
+	var min, max time.Duration = -1, -1
+	for _, value := range values {
+		if value < 0 {
+			continue
+		}
+		if min < 0 || value < min {
+			min = value
+		}
+		if value > max {
+			max = value
+		}
+	}
+	result := strings.Builder{}
+	for _, value := range values {
+		if value < 0 {
+			result.WriteRune(sparkLost)
+			continue
+		}
+		idx := 0
+		if max > min {
+			idx = int(float64(value-min) / float64(max-min) * float64(len(sparkBlocks)-1))
+		}
+		result.WriteRune(sparkBlocks[idx])
+	}
+	return result.String()
+}
+
+// Avg average ping in ms, empty if no data
+func (h *latencyHistory) Avg() string {
+	values := h.successful()
+	if len(values) == 0 {
+		return ""
+	}
+	var sum time.Duration
+	for _, value := range values {
+		sum += value
+	}
+	return formatMS(sum / time.Duration(len(values)))
+}
+
+// P95 95th percentile ping in ms, empty if no data
+func (h *latencyHistory) P95() string {
+	values := h.successful()
+	if len(values) == 0 {
+		return ""
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	idx := int(math.Ceil(float64(len(values))*0.95)) - 1
+	return formatMS(values[idx])
+}
@@ -4,6 +4,7 @@ package main
 
 import (
 	"github.com/getlantern/systray"
+	"github.com/scaleway/scaleway-sdk-go/api/instance/v1"
 )
 
 const appName = "scaleway-tray"
@@ -17,6 +18,12 @@ var GitCommit string
 // Version ...
 var Version = "0.0.0"
 
+var serverActions = map[menuAction]instance.ServerAction{
+	menuPowerOnAction:  instance.ServerActionPoweron,
+	menuPowerOffAction: instance.ServerActionPoweroff,
+	menuRebootAction:   instance.ServerActionReboot,
+}
+
 func main() {
 	systray.Run(onReady, nil)
 }
@@ -32,23 +39,27 @@ func onReady() {
 	}
 	menu := newMenuPool(20)
 	systray.AddSeparator()
+	mTasks := systray.AddMenuItem("Tasks", "Server tasks")
 	mSettings := systray.AddMenuItem("Settings", "Settings")
 	mQuit := systray.AddMenuItem("Quit", "Quit")
 
 	stopper := newSignalHandler()
 	settings := newSettingsStorage()
 	scaleway := newScalewayWorker(settings, menu)
-	pinger := newPingWorker(settings, scaleway.servers, scaleway.CFGChange)
-	gui := newSettingsGUI(settings, scaleway.CFGChange, pinger.CFGChange, stopper.Send)
+	tasks := newTaskTracker(settings, mTasks, 10, scaleway.RefreshServer)
+	sshKeys := newSSHKeyStore()
+	pinger := newPingWorker(settings, scaleway.servers, sshKeys, scaleway.Redraw)
+	gui := newSettingsGUI(settings, scaleway.servers, scaleway.CFGChange, pinger.CFGChange, stopper.Send)
 
 	systray.SetIcon(iconData)
 	systray.SetTitle("Scaleway Tray")
 	systray.SetTooltip("Scaleway Tray")
 
-	stopper.Start(pinger.Quit, scaleway.Quit, gui.Quit, stopMe)
+	stopper.Start(pinger.Quit, tasks.Quit, scaleway.Quit, gui.Quit, stopMe)
 	scaleway.Start(pinger.PingSignal)
 	gui.Start()
 	pinger.Start()
+	tasks.Start()
 	for {
 		select {
 		case <-mQuit.ClickedCh:
@@ -62,10 +73,41 @@ func onReady() {
 			// WARNING: If systray.Quit() call before ui.Quit finished - systray.Run never be stopped (in Linux)
 			gui.Wait()
 			return
-		case num := <-menu.WaitSignal():
-			if err := writeToClipboard(num, settings, scaleway.servers); err != nil {
-				printErr("WriteToClipboard: %v", err)
+		case signal := <-menu.WaitSignal():
+			switch signal.Action {
+			case menuCopyAction:
+				if err := writeToClipboard(signal.Index, signal.Copy, settings, scaleway.servers); err != nil {
+					printErr("WriteToClipboard: %v", err)
+				}
+				continue
+			case menuAcceptSSHKeyAction:
+				if err := acceptSSHKey(signal.Index, scaleway.servers, sshKeys); err != nil {
+					printErr("AcceptSSHKey: %v", err)
+				}
+				scaleway.Redraw()
+				continue
+			case menuKnownHostsAction:
+				if err := writeServerKnownHosts(signal.Index, settings, scaleway.servers, sshKeys); err != nil {
+					printErr("WriteKnownHosts: %v", err)
+				}
+				continue
+			case menuTracerouteAction:
+				name, host, err := tracerouteTarget(signal.Index, scaleway.servers)
+				if err != nil {
+					printErr("Traceroute: %v", err)
+					continue
+				}
+				gui.ShowTraceroute(name, host)
+				continue
 			}
+			go func(signal menuSignal) {
+				task, err := scaleway.ServerAction(signal.Index, serverActions[signal.Action])
+				if err != nil {
+					printErr("%v", err)
+					return
+				}
+				tasks.Track(task)
+			}(signal)
 		}
 	}
 }
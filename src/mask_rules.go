@@ -0,0 +1,100 @@
+package main
+
+import "fmt"
+
+// Override menu and copy format for matched servers
+type maskRule struct {
+	// All not empty must match, like in probe rules
+	ServerID string `json:"server_id"`
+	// Glob, e.g. db-*
+	Name string `json:"name"`
+	Tag  string `json:"tag"`
+
+	// Empty keep global
+	ViewMask string `json:"view_mask"`
+	// For default copy action
+	CopyMask string `json:"copy_mask"`
+
+	// set on load, broken rule is skipped but kept in settings
+	err error
+}
+
+type maskRules []*maskRule
+
+func (r *maskRule) Match(id, name string, tags []string) bool {
+	return matchServer(r.ServerID, r.Name, r.Tag, id, name, tags)
+}
+
+// Template errors of masks, copy mask is checked with copy keys
+func (r *maskRule) validate() error {
+	if err := validateMask(r.ViewMask, true); err != nil {
+		return fmt.Errorf("view_mask: %v", err)
+	}
+	if err := validateMask(r.CopyMask, false); err != nil {
+		return fmt.Errorf("copy_mask: %v", err)
+	}
+	return nil
+}
+
+// Check all rules on load, report broken ones
+func (rules maskRules) validate() {
+	for idx, rule := range rules {
+		if rule == nil {
+			continue
+		}
+		if rule.err = rule.validate(); rule.err != nil {
+			printErr("Mask rule %d: %v", idx+1, rule.err)
+		}
+	}
+}
+
+// Server ID is more specific than name, name than tag
+func (r *maskRule) specificity() int {
+	result := 0
+	if r.ServerID != "" {
+		result += 4
+	}
+	if r.Name != "" {
+		result += 2
+	}
+	if r.Tag != "" {
+		result++
+	}
+	return result
+}
+
+// Most specific value from matched rules, later wins at equal specificity
+func (rules maskRules) pick(id, name string, tags []string, value func(*maskRule) string) (string, bool) {
+	result, best := "", -1
+	for _, rule := range rules {
+		if rule == nil || rule.err != nil || value(rule) == "" || !rule.Match(id, name, tags) {
+			continue
+		}
+		if specificity := rule.specificity(); specificity >= best {
+			result, best = value(rule), specificity
+		}
+	}
+	return result, best >= 0
+}
+
+func (rules maskRules) ViewMask(global string, item *serverInfo) string {
+	if mask, ok := rules.pick(item.ID, item.NAME, item.tags, func(r *maskRule) string { return r.ViewMask }); ok {
+		return mask
+	}
+	return global
+}
+
+// Override only default copy action. Escape mode of action is kept for {KEY} mask of rule,
+// template of rule escapes with own functions
+func (rules maskRules) CopyMask(global, escape string, isDefault bool, item *serverInfo) (string, string) {
+	if !isDefault {
+		return global, escape
+	}
+	if mask, ok := rules.pick(item.ID, item.NAME, item.tags, func(r *maskRule) string { return r.CopyMask }); ok {
+		if isTemplateMask(mask) {
+			escape = escapeNone
+		}
+		return mask, escape
+	}
+	return global, escape
+}
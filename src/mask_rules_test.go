@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+func TestMaskRulesPick(t *testing.T) {
+	rules := maskRules{
+		{Tag: "web", ViewMask: "tag web"},
+		{Name: "web-*", ViewMask: "name web-*"},
+		{Tag: "env=prod", ViewMask: "tag prod"},
+		{ServerID: "id-1", ViewMask: "id-1"},
+		{Tag: "web", CopyMask: "copy only"},
+		{Name: "db-*", Tag: "env=prod", ViewMask: "name and tag"},
+		{Name: "db-*", ViewMask: "name db-*"},
+		{Name: "db-9", ViewMask: "{{.FOO}}"},
+		nil,
+	}
+	rules.validate()
+	tests := []struct {
+		id, name string
+		tags     []string
+		want     string
+	}{
+		{"id-0", "mail", nil, "global"},
+		{"id-0", "mail", []string{"web"}, "tag web"},
+		// later wins at equal specificity
+		{"id-0", "mail", []string{"web", "env=prod"}, "tag prod"},
+		// name over tag
+		{"id-0", "web-2", []string{"web", "env=prod"}, "name web-*"},
+		// server id over all
+		{"id-1", "web-2", []string{"web"}, "id-1"},
+		// name and tag over name, even earlier
+		{"id-0", "db-1", []string{"env=prod"}, "name and tag"},
+		{"id-0", "db-1", nil, "name db-*"},
+		// broken rule is skipped
+		{"id-0", "db-9", nil, "name db-*"},
+	}
+	for _, test := range tests {
+		item := &serverInfo{ID: test.id, NAME: test.name, tags: test.tags}
+		if result := rules.ViewMask("global", item); result != test.want {
+			t.Errorf("ViewMask(%s, %s, %v) = %q, want %q", test.id, test.name, test.tags, result, test.want)
+		}
+	}
+	if rules[7].err == nil {
+		t.Error("broken rule is not reported")
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode/utf8"
+)
+
+// Masks with {{ are text/template, else legacy {KEY}
+const templateMarker = "{{"
+
+var errTemplateEscape = errors.New("Escape mode works only with {KEY} masks, use shell, url or json functions in templates")
+
+var legacyKeyRe = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// Error of template with missingkey=error, field path and missed key
+var missingKeyRe = regexp.MustCompile(`at <\.([^>]*)>: map has no entry for key "([^"]*)"`)
+
+// Parsed templates by text. Masks change rarely, so parse once
+var templateCache = struct {
+	D map[string]*template.Template
+	L sync.Mutex
+}{D: map[string]*template.Template{}}
+
+// Cache is dropped when full, old masks aren't used anymore
+const templateCacheSize = 100
+
+var templateFuncs = template.FuncMap{
+	// default "-" .HOSTNAME
+	"default": func(def string, value interface{}) interface{} {
+		if value == nil || value == "" {
+			return def
+		}
+		return value
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	// pad 10 .NAME - right padding to width
+	"pad": func(width int, value string) string {
+		if count := width - utf8.RuneCountInString(value); count > 0 {
+			return value + strings.Repeat(" ", count)
+		}
+		return value
+	},
+	// trunc 10 .NAME
+	"trunc": func(width int, value string) string {
+		if utf8.RuneCountInString(value) <= width {
+			return value
+		}
+		return string([]rune(value)[:width])
+	},
+	// date "2006-01-02" .Created
+	"date": func(layout string, value time.Time) string {
+		if value.IsZero() {
+			return ""
+		}
+		return value.Local().Format(layout)
+	},
+	// ago .Created - duration in format from settings
+	"ago": func(value time.Time) string {
+		return formatSince(value, getDurationFormat())
+	},
+	// join ", " .Tags
+	"join": func(sep string, values []string) string {
+		return strings.Join(values, sep)
+	},
+	// {{shell .NAME}}, {{url .NAME}}, {{json .NAME}}
+	"shell": shellQuote,
+	"url":   urlEscape,
+	"json":  jsonEscape,
+}
+
+func isTemplateMask(mask string) bool {
+	return strings.Contains(mask, templateMarker)
+}
+
+// Parsed template from cache. Unknown keys are errors
+func parseTemplateMask(mask string) (*template.Template, error) {
+	templateCache.L.Lock()
+	defer templateCache.L.Unlock()
+	if tpl, ok := templateCache.D[mask]; ok {
+		return tpl, nil
+	}
+	tpl, err := template.New("mask").Funcs(templateFuncs).Option("missingkey=error").Parse(mask)
+	if err != nil {
+		return nil, err
+	}
+	if len(templateCache.D) >= templateCacheSize {
+		templateCache.D = map[string]*template.Template{}
+	}
+	templateCache.D[mask] = tpl
+	return tpl, nil
+}
+
+// Data for text/template: all {KEY} values and server record
+func templateData(data *serverInfo, values map[string]string) map[string]interface{} {
+	result := make(map[string]interface{}, len(values)+4)
+	for key, value := range values {
+		result[key] = value
+	}
+	checks := map[string]checkResult{}
+	for name, check := range data.checks {
+		checks[name] = check
+	}
+	// no placeholders, for {{if .IPv6}}
+	if !data.isIPv4 {
+		result["IPv4"] = ""
+	}
+	if !data.isIPv6 {
+		result["IPv6"] = ""
+	}
+	if !data.isIPv4 && !data.isIPv6 {
+		result["IPvX"] = ""
+	}
+	tagMap := make(map[string]string, len(data.tagMap))
+	for key, value := range data.tagMap {
+		tagMap[key] = value
+	}
+	result["Tags"] = append([]string{}, data.tags...)
+	result["TagMap"] = tagMap
+	result["Checks"] = checks
+	result["Created"] = data.created
+	result["Modified"] = data.modified
+	result["StateSince"] = data.stateSince
+	return result
+}
+
+func renderMask(mask string, data *serverInfo, view bool, escapeMode string) string {
+	result, err := executeMask(mask, data, view, escapeMode)
+	if err != nil {
+		return err.Error()
+	}
+	return result
+}
+
+// Fill mask, values of {KEY} masks are escaped with escapeMode.
+// Templates escape with functions, so escapeMode is an error for them
+func executeMask(mask string, data *serverInfo, view bool, escapeMode string) (string, error) {
+	return executeMaskStyle(mask, data, view, escapeMode, nil)
+}
+
+// Fill mask with style not applied yet, e.g. for preview. nil for active style
+func executeMaskStyle(mask string, data *serverInfo, view bool, escapeMode string, style *maskStyle) (string, error) {
+	explicit := style != nil
+	if !explicit {
+		style = activeMaskStyle()
+	}
+	values := maskValues(data, view, style)
+	if !isTemplateMask(mask) {
+		escape := escapeFunc(escapeMode)
+		for key, value := range values {
+			values[key] = escape(value)
+		}
+		return legacyKeyRe.ReplaceAllStringFunc(mask, func(key string) string {
+			name := key[1 : len(key)-1]
+			if value, ok := values[name]; ok {
+				return value
+			}
+			// absent tags are empty, {TAG:env|default}
+			if strings.HasPrefix(name, "TAG:") {
+				return escape(tagValue(data.tagMap, name[4:]))
+			}
+			if strings.HasPrefix(name, "HAS_TAG:") {
+				return ""
+			}
+			return key
+		}), nil
+	}
+	if escapeMode != escapeNone {
+		return "", errTemplateEscape
+	}
+	tpl, err := parseTemplateMask(mask)
+	if err != nil {
+		return "", err
+	}
+	if explicit {
+		// cached template is shared
+		if tpl, err = tpl.Clone(); err != nil {
+			return "", err
+		}
+		tpl.Funcs(template.FuncMap{"ago": func(value time.Time) string {
+			return formatSince(value, style.duration)
+		}})
+	}
+	var result bytes.Buffer
+	if err = tpl.Execute(&result, templateData(data, values)); err != nil {
+		return "", err
+	}
+	return result.String(), nil
+}
+
+// Syntax error or unknown fields of template, nil for legacy masks. View masks have more keys than copy masks
+func validateMask(mask string, view bool) error {
+	if !isTemplateMask(mask) {
+		return nil
+	}
+	if _, err := parseTemplateMask(mask); err != nil {
+		return err
+	}
+	if unknown := unknownMaskKeys(mask, sampleServerInfo(), view); len(unknown) > 0 {
+		return fmt.Errorf("Unknown keys: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// Keys not known for server, {KEY} or .KEY of template. Tags and checks are known for any name
+func unknownMaskKeys(mask string, data *serverInfo, view bool) []string {
+	if isTemplateMask(mask) {
+		tpl, err := parseTemplateMask(mask)
+		if err != nil {
+			return nil
+		}
+		return unknownTemplateKeys(tpl, templateData(data, maskValues(data, view, activeMaskStyle())))
+	}
+	values := maskValues(data, view, activeMaskStyle())
+	result := []string{}
+	for _, match := range legacyKeyRe.FindAllStringSubmatch(mask, -1) {
+		key := match[1]
+		if _, ok := values[key]; ok {
+			continue
+		}
+		if strings.HasPrefix(key, "CHECK:") || strings.HasPrefix(key, "CHECK_OUT:") || strings.HasPrefix(key, "CHECK_PERF:") ||
+			strings.HasPrefix(key, "TAG:") || strings.HasPrefix(key, "HAS_TAG:") {
+			continue
+		}
+		result = append(result, match[0])
+	}
+	return result
+}
+
+// Execute until no missed keys. Unknown key is added as empty to find the next one,
+// absent tags and checks are added too
+func unknownTemplateKeys(tpl *template.Template, data map[string]interface{}) []string {
+	result := []string{}
+	for {
+		err := tpl.Execute(ioutil.Discard, data)
+		if err == nil {
+			return result
+		}
+		match := missingKeyRe.FindStringSubmatch(err.Error())
+		if match == nil {
+			return result
+		}
+		field, key := match[1], match[2]
+		switch {
+		case field == key || strings.HasPrefix(field, key+"."):
+			if _, ok := data[key]; ok {
+				return result
+			}
+			result = append(result, "."+key)
+			data[key] = ""
+			if field != key {
+				// map for .KEY.field
+				data[key] = map[string]interface{}{}
+			}
+		case isUnknownField(result, field):
+			// nested field of unknown key
+			parent := data
+			for _, name := range strings.Split(field, ".") {
+				next, ok := parent[name].(map[string]interface{})
+				if !ok {
+					break
+				}
+				parent = next
+			}
+			if _, ok := parent[key]; ok {
+				return result
+			}
+			parent[key] = map[string]interface{}{}
+		case field == "TagMap."+key:
+			data["TagMap"].(map[string]string)[key] = ""
+		case field == "Checks."+key || strings.HasPrefix(field, "Checks."+key+"."):
+			data["Checks"].(map[string]checkResult)[key] = checkResult{}
+		default:
+			return result
+		}
+	}
+}
+
+func isUnknownField(unknown []string, field string) bool {
+	for _, key := range unknown {
+		if strings.HasPrefix("."+field, key+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Server for preview when no servers or "Sample data" selected
+func sampleServerInfo() *serverInfo {
+	item := &serverInfo{
+		ID:       "11111111-2222-3333-4444-555555555555",
+		NAME:     "web-1",
+		HOSTNAME: "web-1",
+		IPv4:     "192.0.2.10",
+		IPv6:     "2001:db8::10",
+		private:  "10.1.2.3",
+		STATE:    "running",
+		REGION:   "par1",
+		isIPv4:   true,
+		isIPv6:   true,
+		tags:     []string{"web", "env=prod"},
+		tagMap:   map[string]string{"web": "", "env": "prod"},
+		created:  time.Now().Add(-time.Hour * 24 * 40),
+		modified: time.Now().Add(-time.Hour * 5),
+	}
+	item.stateSince = item.modified
+	item.pingState, item.pingState4, item.pingState6 = true, true, true
+	item.pingMS, item.pingMS4, item.pingMS6 = "12", "12", "14"
+	item.pingMin, item.pingMax, item.jitter, item.loss = "10", "15", "2", "0"
+	item.health.state = aliveUp
+	for _, rtt := range []int{10, 12, 15, 11, 12} {
+		item.history.Add(time.Millisecond*time.Duration(rtt), true)
+	}
+	return item
+}
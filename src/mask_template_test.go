@@ -0,0 +1,65 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUnknownMaskKeys(t *testing.T) {
+	tests := []struct {
+		mask string
+		want []string
+	}{
+		{"{NAME} {IPv4}", []string{}},
+		{"{NAME} {FOO} {TAG:env} {CHECK:disk}", []string{"{FOO}"}},
+		{"{{.NAME}} {{.IPvX}}", []string{}},
+		{"{{.NAME}} {{.FOO}} {{.BAZ}}", []string{".FOO", ".BAZ"}},
+		{"{{if .QUX}}x{{end}}", []string{".QUX"}},
+		{"{{.BAR.x.y}} {{.BAR.z}} {{.FOO}}", []string{".BAR", ".FOO"}},
+		{"{{.TagMap.team}} {{.Checks.disk.Status}} {{.FOO}}", []string{".FOO"}},
+		{`{{index .TagMap "team"}} {{index . "CHECK:disk"}}`, []string{}},
+	}
+	for _, test := range tests {
+		if result := unknownMaskKeys(test.mask, sampleServerInfo(), true); !reflect.DeepEqual(result, test.want) {
+			t.Errorf("unknownMaskKeys(%q) = %q, want %q", test.mask, result, test.want)
+		}
+	}
+}
+
+func TestValidateMaskUnknownKeys(t *testing.T) {
+	if err := validateMask("{{.NAME}} {{.FOO}}", true); err == nil || err.Error() != "Unknown keys: .FOO" {
+		t.Errorf("validateMask with unknown key = %v", err)
+	}
+	if err := validateMask("{{.NAME}} {{.TagMap.team}}", true); err != nil {
+		t.Errorf("validateMask with absent tag = %v", err)
+	}
+	// legacy unknown keys are kept in result, not errors
+	if err := validateMask("{NAME} {FOO}", true); err != nil {
+		t.Errorf("validateMask of legacy mask = %v", err)
+	}
+	// symbols are only for menu
+	if err := validateMask("{{.ALIVE}} {{.FLAG}} {{.NAME}}", true); err != nil {
+		t.Errorf("validateMask of view mask = %v", err)
+	}
+	if err := validateMask("{{.ALIVE}} {{.FLAG}} {{.NAME}}", false); err == nil || err.Error() != "Unknown keys: .ALIVE, .FLAG" {
+		t.Errorf("validateMask of copy mask with view keys = %v", err)
+	}
+}
+
+// Preview style is explicit, active symbols of worker stay
+func TestExecuteMaskStyleSymbols(t *testing.T) {
+	item := sampleServerInfo()
+	style := &maskStyle{duration: durationShort, symbols: newSymbolSet(symbolsASCII, nil)}
+	for _, mask := range []string{"{ALIVE}", "{{.ALIVE}}"} {
+		result, err := executeMaskStyle(mask, item, true, escapeNone, style)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := style.symbols.health(aliveUp); result != want {
+			t.Errorf("mask %q: got %q, want %q", mask, result, want)
+		}
+		if result, _ = executeMask(mask, item, true, escapeNone); result != getSymbols().health(aliveUp) {
+			t.Errorf("mask %q with active symbols: got %q", mask, result)
+		}
+	}
+}
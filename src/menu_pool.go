@@ -2,33 +2,114 @@ package main
 
 import "github.com/getlantern/systray"
 
+type menuAction uint8
+
+const (
+	menuCopyAction menuAction = iota
+	menuPowerOnAction
+	menuPowerOffAction
+	menuRebootAction
+	menuAcceptSSHKeyAction
+	menuKnownHostsAction
+	menuTracerouteAction
+)
+
+var menuActions = []struct {
+	action menuAction
+	title  string
+}{
+	{menuPowerOnAction, "Power on"},
+	{menuPowerOffAction, "Power off"},
+	{menuRebootAction, "Reboot"},
+	{menuAcceptSSHKeyAction, "Accept new SSH key"},
+	{menuKnownHostsAction, "Write to known_hosts"},
+	{menuTracerouteAction, "Traceroute"},
+}
+
+// Hidden until SetActionVisible
+var menuOptionalActions = []menuAction{menuAcceptSSHKeyAction, menuKnownHostsAction}
+
+// menuSignal - clicked action of server menu item
+type menuSignal struct {
+	Index  int
+	Action menuAction
+	// copy action for menuCopyAction, -1 for default
+	Copy int
+}
+
 type menuPool struct {
 	// read-only
-	_menu []*systray.MenuItem
-	_c    chan int
-	_len  int
+	_menu   []*systray.MenuItem
+	_status []*systray.MenuItem
+	_sub    []map[menuAction]*systray.MenuItem
+	_copy   [][]*systray.MenuItem
+	_c      chan menuSignal
+	_len    int
 }
 
 func newMenuPool(size int) *menuPool {
 	menu := menuPool{
-		_menu: make([]*systray.MenuItem, size),
-		_c:    make(chan int, 1),
+		_menu:   make([]*systray.MenuItem, size),
+		_status: make([]*systray.MenuItem, size),
+		_sub:    make([]map[menuAction]*systray.MenuItem, size),
+		_copy:   make([][]*systray.MenuItem, size),
+		_c:      make(chan menuSignal, 1),
 	}
 	for idx := range menu._menu {
 		menu._menu[idx] = systray.AddMenuItem("", "")
 		menu._menu[idx].Hide()
 
+		// parent with submenu may not report clicks on some platforms, see default item below
 		go func(id int, ch chan struct{}) {
 			for range ch {
-				menu._c <- id
+				menu._c <- menuSignal{id, menuCopyAction, -1}
 			}
 		}(idx, menu._menu[idx].ClickedCh)
+
+		menu._status[idx] = menu._menu[idx].AddSubMenuItem("", "")
+		menu._status[idx].Disable()
+		menu._status[idx].Hide()
+
+		copyDefault := menu._menu[idx].AddSubMenuItem("Copy (default)", "Copy (default)")
+		go func(id int, ch chan struct{}) {
+			for range ch {
+				menu._c <- menuSignal{id, menuCopyAction, -1}
+			}
+		}(idx, copyDefault.ClickedCh)
+
+		menu._copy[idx] = make([]*systray.MenuItem, copySlots)
+		for slot := range menu._copy[idx] {
+			sub := menu._menu[idx].AddSubMenuItem("", "")
+			sub.Hide()
+			menu._copy[idx][slot] = sub
+			go func(id, slot int, ch chan struct{}) {
+				for range ch {
+					menu._c <- menuSignal{id, menuCopyAction, slot}
+				}
+			}(idx, slot, sub.ClickedCh)
+		}
+
+		menu._sub[idx] = map[menuAction]*systray.MenuItem{}
+		for _, item := range menuActions {
+			sub := menu._menu[idx].AddSubMenuItem(item.title, item.title)
+			menu._sub[idx][item.action] = sub
+			go func(id int, action menuAction, ch chan struct{}) {
+				for range ch {
+					menu._c <- menuSignal{id, action, -1}
+				}
+			}(idx, item.action, sub.ClickedCh)
+		}
+	}
+	for idx := range menu._menu {
+		for _, action := range menuOptionalActions {
+			menu._sub[idx][action].Hide()
+		}
 	}
 	menu._len = len(menu._menu)
 	return &menu
 }
 
-func (m *menuPool) WaitSignal() <-chan int {
+func (m *menuPool) WaitSignal() <-chan menuSignal {
 	return m._c
 }
 
@@ -42,6 +123,62 @@ func (m *menuPool) HideAll() {
 	}
 }
 
+// SetWarning show warning in tray title and tooltip, empty for clear
+func (m *menuPool) SetWarning(text string) {
+	if text == "" {
+		systray.SetTitle("Scaleway Tray")
+		systray.SetTooltip("Scaleway Tray")
+		return
+	}
+	symbol := getSymbols().Warning
+	if symbol != "" {
+		symbol += " "
+	}
+	systray.SetTitle(symbol + "Scaleway Tray")
+	systray.SetTooltip("Scaleway Tray\n" + symbol + text)
+}
+
+// SetCopyActions set titles of copy actions in all server submenus
+func (m *menuPool) SetCopyActions(names []string) {
+	for _, slots := range m._copy {
+		for slot, item := range slots {
+			if slot < len(names) {
+				item.SetTitle(names[slot])
+				item.Show()
+			} else {
+				item.Hide()
+			}
+		}
+	}
+}
+
+// SetActionVisible show or hide action in server submenu
+func (m *menuPool) SetActionVisible(index int, action menuAction, visible bool) {
+	if index >= m._len {
+		return
+	}
+	if item, ok := m._sub[index][action]; ok {
+		if visible {
+			item.Show()
+		} else {
+			item.Hide()
+		}
+	}
+}
+
+// UpdateStatus set status line in server submenu, empty for hide
+func (m *menuPool) UpdateStatus(index int, status string) {
+	if index >= m._len {
+		return
+	}
+	if status == "" {
+		m._status[index].Hide()
+		return
+	}
+	m._status[index].SetTitle(status)
+	m._status[index].Show()
+}
+
 func (m *menuPool) UpdateTitle(index int, title string, andShow bool) bool {
 	if index >= m._len {
 		return false
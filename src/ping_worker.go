@@ -1,14 +1,17 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
 	"os"
-	"runtime"
+	"reflect"
 	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
-
-	"github.com/sparrc/go-ping"
 )
 
 type pingWorker struct {
@@ -17,19 +20,54 @@ type pingWorker struct {
 	stopChan      chan os.Signal
 	cfgChangeChan chan struct{}
 	pingSignals   chan struct{}
-	scalewayCFG   func(cfgActionID)
+	redraw        func()
+	sshKeys       *sshKeyStore
+	doneChan      chan probeDone
+	// cancel running probes on quit
+	ctx    context.Context
+	cancel context.CancelFunc
+	// only for loop goroutine
+	schedule map[serverID]time.Time
+	running  map[serverID]bool
+	// last SSH probe
+	sshChecked map[serverID]time.Time
+}
+
+// Tick of scheduler
+const schedulerTick = time.Millisecond * 250
+
+// Finished probe, committed to servers with the batch of its tick
+type probeDone struct {
+	id       serverID
+	interval time.Duration
+	result   probeResult
+	// of chosen family
+	alive         bool
+	rtt           time.Duration
+	upThreshold   int
+	downThreshold int
+	// false if SSH probe skipped, last result is kept
+	sshProbed bool
 }
 
-func newPingWorker(data *settingsStorage, servers *serversInfo, scalewayCFG func(cfgActionID)) *pingWorker {
+func newPingWorker(data *settingsStorage, servers *serversInfo, sshKeys *sshKeyStore, redraw func()) *pingWorker {
 	pg := pingWorker{}
 
 	pg.stopChan = make(chan os.Signal, 1)
 	pg.cfgChangeChan = make(chan struct{}, 1)
 	pg.pingSignals = make(chan struct{}, 1)
+	pg.doneChan = make(chan probeDone, 100)
+	pg.schedule = map[serverID]time.Time{}
+	pg.running = map[serverID]bool{}
+	pg.sshChecked = map[serverID]time.Time{}
+	pg.ctx, pg.cancel = context.WithCancel(context.Background())
 
 	pg.data = data
 	pg.servers = servers
-	pg.scalewayCFG = scalewayCFG
+	pg.redraw = redraw
+	pg.sshKeys = sshKeys
+	// detect at startup
+	getProbeMode()
 
 	return &pg
 }
@@ -39,95 +77,559 @@ func (pg *pingWorker) Start() {
 }
 
 func (pg *pingWorker) loop() {
-	var timerChan <-chan time.Time
-	var pingInterval time.Duration
+	var enable bool
+	var concurrency int
 	initTimer := func() {
 		pg.data.L.RLock()
 		defer pg.data.L.RUnlock()
-		pingInterval = time.Duration(pg.data.D.PingInterval)
-	}
-
-	makeTimer := func() {
-		if pingInterval >= 1 {
-			timerChan = time.After(time.Second * pingInterval)
-		} else {
-			timerChan = make(<-chan time.Time, 1)
+		enable = pg.data.D.PingInterval >= 1
+		concurrency = pg.data.D.ProbeConcurrency
+		if concurrency < 1 {
+			concurrency = 1
 		}
+		externalLimiter.SetLimit(pg.data.D.ExternalConcurrency)
 	}
-
 	initTimer()
-	makeTimer()
 
+	// results since last tick
+	batch := []probeDone{}
+	ticker := time.NewTicker(schedulerTick)
+	defer ticker.Stop()
 	for {
 		select {
 		case <-pg.stopChan:
+			pg.cancel()
 			return
-		case <-time.After(time.Microsecond * 800):
-			select {
-			case <-pg.cfgChangeChan:
-				initTimer()
-				makeTimer()
-			default:
-			}
+		case <-pg.cfgChangeChan:
+			initTimer()
 		case <-pg.pingSignals:
-			if pingInterval >= 1 {
-				pg.ping()
-				makeTimer()
+			if enable {
+				pg.dispatch(concurrency, true)
+			}
+		case done := <-pg.doneChan:
+			delete(pg.running, done.id)
+			pg.schedule[done.id] = time.Now().Add(withJitter(done.interval))
+			batch = append(batch, done)
+		case <-ticker.C:
+			if len(batch) > 0 {
+				pg.commit(batch)
+				batch = batch[:0]
+			}
+			if enable {
+				pg.dispatch(concurrency, false)
 			}
-		case <-timerChan:
-			pg.ping()
-			makeTimer()
 		}
 	}
 }
 
-func (pg *pingWorker) ping() {
-	wg := sync.WaitGroup{}
+// Interval +-10%
+func withJitter(interval time.Duration) time.Duration {
+	if interval < time.Second {
+		return interval
+	}
+	return interval - interval/10 + time.Duration(rand.Int63n(int64(interval/5)))
+}
 
+type aliveState uint8
+
+const (
+	aliveUnknown aliveState = iota
+	aliveUp
+	aliveDegraded
+	aliveDown
+)
+
+// Hysteresis for ping state
+type healthState struct {
+	state aliveState
+	fails int
+	oks   int
+}
+
+// Update with new probe result, return true if state changed.
+// Down after downThreshold failures, up after upThreshold successes, degraded between
+func (h *healthState) Update(alive bool, upThreshold, downThreshold int) bool {
+	old := h.state
+	if alive {
+		h.oks++
+		h.fails = 0
+	} else {
+		h.fails++
+		h.oks = 0
+	}
+	switch {
+	case h.state == aliveUnknown && alive:
+		h.state = aliveUp
+	case h.state == aliveUnknown:
+		h.state = aliveDown
+	case alive && h.oks >= upThreshold:
+		h.state = aliveUp
+	case !alive && h.fails >= downThreshold:
+		h.state = aliveDown
+	case alive && h.state == aliveDown, !alive && h.state == aliveUp:
+		h.state = aliveDegraded
+	}
+	return old != h.state
+}
+
+// For TCP ping if ports not configured
+var tcpFallbackPorts = []int{22, 80, 443}
+
+type portState struct {
+	Port int
+	Open bool
+}
+
+// Result of all probes for one server
+type probeResult struct {
+	pingState bool
+	pingMS    string
+	ports     []portState
+	// empty if check not configured
+	httpState string
+	httpMS    string
+	// empty if check not configured
+	certDays   string
+	certIssuer string
+	certWarn   bool
+	// error of TLS check, certificate not read
+	certStatus string
+	// empty if check not configured
+	dnsState  string
+	dnsStatus string
+	// empty if check not configured
+	sshFingerprint string
+	sshChanged     bool
+	// by check name
+	checks map[string]checkResult
+	// ICMP statistics
+	loss    string
+	jitter  string
+	pingMin string
+	pingMax string
+	// per address family
+	pingState4 bool
+	pingState6 bool
+	pingMS4    string
+	pingMS6    string
+	// IPvX and ALIVE use IPv6
+	useIPv6 bool
+}
+
+func (r *probeResult) equal(other *probeResult) bool {
+	return reflect.DeepEqual(r, other)
+}
+
+type probeTarget struct {
+	id serverID
+	// probe type from rules
+	probe string
+	// for TCP ports probe
+	host        string
+	host4       string
+	host6       string
+	prefer      string
+	ports       []int
+	http        *httpCheck
+	httpURL     string
+	httpAlive   bool
+	tls         *tlsCheck
+	tlsAddr     string
+	tlsSNI      string
+	tlsWarn     int
+	dnsName     string
+	dnsResolver string
+	dnsExpected []string
+	sshAddress  string
+	name        string
+	checks      []preparedCheck
+	icmp        icmpOptions
+	// consecutive probes for state change
+	upThreshold   int
+	downThreshold int
+}
+
+type preparedCheck struct {
+	name    string
+	args    []string
+	timeout time.Duration
+}
+
+type icmpOptions struct {
+	count    int
+	interval time.Duration
+	timeout  time.Duration
+	// down if packet loss >= threshold, in percent
+	lossThreshold float64
+}
+
+// Start probes for due servers, no more than concurrency at the same time.
+// New servers are spread evenly over the interval, or start now if force
+func (pg *pingWorker) dispatch(concurrency int, force bool) {
+	now := time.Now()
+
+	pg.data.L.RLock()
+	defer pg.data.L.RUnlock()
 	pg.servers.L.RLock()
-	for id, item := range pg.servers.D {
-		host := item.IPv4
-		if !item.isIPv4 {
-			host = item.IPv6
+	defer pg.servers.L.RUnlock()
+
+	for id := range pg.schedule {
+		if _, ok := pg.servers.D[id]; !ok {
+			delete(pg.schedule, id)
+			delete(pg.sshChecked, id)
+		}
+	}
+	newcomers := []serverID{}
+	for _, id := range pg.servers.ServersList {
+		item, ok := pg.servers.D[id]
+		if !ok || pg.running[id] {
+			continue
+		}
+		rule := pg.data.D.probeRuleFor(item.ID, item.NAME, item.tags)
+		if rule.IsUnmonitored() || !(item.isIPv4 || item.isIPv6 || rule.Target != "") {
+			delete(pg.schedule, id)
+			continue
+		}
+		due, ok := pg.schedule[id]
+		if !ok {
+			if !force {
+				newcomers = append(newcomers, id)
+				continue
+			}
+			due = now
+		}
+		if force {
+			due = now
+			pg.schedule[id] = due
+		}
+		if due.After(now) || len(pg.running) >= concurrency {
+			continue
+		}
+		interval := time.Second * time.Duration(pg.data.D.PingInterval)
+		if rule.Interval > 0 {
+			interval = time.Second * time.Duration(rule.Interval)
 		}
-		if item.isIPv4 || item.isIPv6 {
-			wg.Add(1)
-			go pg.pingHost(host, id, item.pingState, item.pingMS, &wg)
+		target := newProbeTarget(pg.data.D, id, item, &rule)
+		if target.host == "" {
+			// rule target rendered empty, e.g. absent tag, state stays as is
+			printErr("Probe %s: empty target %q", item.NAME, rule.Target)
+			pg.schedule[id] = now.Add(withJitter(interval))
+			continue
 		}
+		if target.sshAddress != "" {
+			// SSH handshake is heavy, not on every ping
+			last, ok := pg.sshChecked[id]
+			sshInterval := time.Second * time.Duration(pg.data.D.SSHInterval)
+			if ok && now.Sub(last) < sshInterval && !item.stateSince.After(last) {
+				target.sshAddress = ""
+			} else {
+				pg.sshChecked[id] = now
+			}
+		}
+		pg.running[id] = true
+		go pg.pingHost(target, interval)
 	}
-	pg.servers.L.RUnlock()
 
-	wg.Wait()
+	globalInterval := time.Second * time.Duration(pg.data.D.PingInterval)
+	for idx, id := range newcomers {
+		pg.schedule[id] = now.Add(globalInterval * time.Duration(idx) / time.Duration(len(newcomers)))
+	}
+}
+
+// Make target from settings and server, call under locks
+func newProbeTarget(cfg *settingsData, id serverID, item *serverInfo, rule *probeRule) probeTarget {
+	icmp := icmpOptions{
+		count:         cfg.PingCount,
+		interval:      time.Millisecond * time.Duration(cfg.PingPacketInterval),
+		timeout:       time.Second * time.Duration(cfg.PingTimeout),
+		lossThreshold: float64(cfg.PingLossThreshold),
+	}
+	if icmp.timeout <= 0 {
+		icmp.timeout = time.Second * 5
+	}
+	prefer := cfg.IPPreference
+
+	target := probeTarget{id: id, icmp: icmp, prefer: prefer, probe: rule.Probe}
+	target.upThreshold = cfg.UpThreshold
+	target.downThreshold = cfg.DownThreshold
+	if rule.Timeout > 0 {
+		target.icmp.timeout = time.Second * time.Duration(rule.Timeout)
+	}
+	if rule.Target != "" {
+		address := strings.TrimSpace(fillMask(rule.Target, item))
+		if ip := net.ParseIP(address); ip != nil && ip.To4() == nil {
+			target.host6 = address
+		} else {
+			target.host4 = address
+		}
+	} else {
+		if item.isIPv4 {
+			target.host4 = item.IPv4
+		}
+		if item.isIPv6 {
+			target.host6 = item.IPv6
+		}
+	}
+	target.host = target.host4
+	if target.host == "" || (prefer == ipPreferV6 && target.host6 != "") {
+		target.host = target.host6
+	}
+	target.ports = cfg.tcpPortsFor(item.ID, item.NAME, item.tags)
+	if target.http = cfg.httpCheckFor(item.ID, item.NAME, item.tags); target.http != nil {
+		target.httpURL = fillMask(target.http.URL, item)
+		target.httpAlive = cfg.HTTPAffectsAlive
+	}
+	if target.tls = cfg.tlsCheckFor(item.ID, item.NAME, item.tags); target.tls != nil {
+		target.tlsAddr = fillMask(target.tls.Address, item)
+		target.tlsSNI = fillMask(target.tls.SNI, item)
+		target.tlsWarn = cfg.TLSWarnDays
+	}
+	if template := cfg.dnsTemplateFor(item.tags); template != "" {
+		target.dnsName = fillMask(template, item)
+		target.dnsResolver = cfg.DNSResolver
+		target.dnsExpected = item.addresses()
+	}
+	if cfg.SSHCheck {
+		target.sshAddress = sshAddress(target.host, cfg.SSHPort)
+		target.name = item.NAME
+	}
+	for _, check := range cfg.ExternalChecks {
+		if check.Tag != "" && !matchTag(item.tags, check.Tag) {
+			continue
+		}
+		timeout := time.Second * 10
+		if check.Timeout > 0 {
+			timeout = time.Second * time.Duration(check.Timeout)
+		}
+		target.checks = append(target.checks, preparedCheck{check.Name, prepareCommand(check.Command, item), timeout})
+	}
+	return target
 }
 
-func (pg *pingWorker) pingHost(host string, id serverID, oldState bool, oldPingMS string, wg *sync.WaitGroup) {
-	defer wg.Done()
-	pinger, err := ping.NewPinger(host)
-	if err != nil {
-		printErr("NewPinger %s: %v", host, err)
-		return
+func (pg *pingWorker) pingHost(target probeTarget, interval time.Duration) {
+	done := probeDone{id: target.id, interval: interval}
+	done.upThreshold, done.downThreshold = target.upThreshold, target.downThreshold
+	defer func() {
+		pg.doneChan <- done
+	}()
+	result := probeResult{}
+	var tcpRtt time.Duration
+	if len(target.ports) > 0 {
+		result.ports, tcpRtt = probePorts(target.host, target.ports, target.icmp.timeout)
 	}
-	if runtime.GOOS == "windows" {
-		pinger.SetPrivileged(true)
+	var httpOK bool
+	if target.http != nil {
+		var httpRtt time.Duration
+		httpOK, httpRtt = checkHTTP(target.http, target.httpURL)
+		result.httpState = pingERR
+		if httpOK {
+			result.httpState = pingOK
+		}
+		result.httpMS = formatMS(httpRtt)
+	}
+	if target.tls != nil {
+		if cert, err := checkTLS(target.tls, target.tlsAddr, target.tlsSNI); err == nil {
+			days := cert.Days()
+			result.certDays = strconv.Itoa(days)
+			result.certIssuer = cert.Issuer
+			result.certWarn = days < target.tlsWarn
+		} else {
+			printErr("TLS check %s: %v", target.tlsAddr, err)
+			result.certDays = pingERR
+			result.certStatus = "TLS: " + err.Error()
+		}
 	}
-	pinger.Count = 1
-	pinger.Timeout = time.Second * 5
-	pinger.Run()
-	statistics := pinger.Statistics()
-	newState := statistics.PacketsRecv > 0
-	newPingMS := strconv.FormatInt((statistics.AvgRtt / time.Millisecond).Nanoseconds(), 10)
-	if oldState == newState && (newPingMS == oldPingMS || !newState) {
-		return
+	if target.dnsName != "" {
+		if err := checkDNS(target.dnsName, target.dnsResolver, target.dnsExpected, target.icmp.timeout); err == nil {
+			result.dnsState = pingOK
+		} else {
+			result.dnsState = pingERR
+			result.dnsStatus = "DNS: " + err.Error()
+		}
 	}
+	done.sshProbed = target.sshAddress != ""
+	if done.sshProbed {
+		if key, err := getSSHHostKey(target.sshAddress, target.icmp.timeout); err == nil {
+			result.sshFingerprint, result.sshChanged = pg.sshKeys.Check(target.id, target.name, key)
+		} else {
+			printErr("SSH check %s: %v", target.sshAddress, err)
+		}
+	}
+	if len(target.checks) > 0 {
+		result.checks = map[string]checkResult{}
+		checksLock := sync.Mutex{}
+		checksWG := sync.WaitGroup{}
+		for _, check := range target.checks {
+			checksWG.Add(1)
+			go func(check preparedCheck) {
+				defer checksWG.Done()
+				value := runExternalCheck(check.args, check.timeout)
+				checksLock.Lock()
+				result.checks[check.name] = value
+				checksLock.Unlock()
+			}(check)
+		}
+		checksWG.Wait()
+	}
+
+	// both families at the same time
+	var statistics4, statistics6 *proberResult
+	familyWG := sync.WaitGroup{}
+	for _, host := range []string{target.host4, target.host6} {
+		if host == "" {
+			continue
+		}
+		familyWG.Add(1)
+		go func(host string) {
+			defer familyWG.Done()
+			statistics := pingAny(pg.ctx, proberTarget{host, target.ports, target.icmp}, target.probe)
+			if host == target.host4 {
+				statistics4 = statistics
+			} else {
+				statistics6 = statistics
+			}
+		}(host)
+	}
+	familyWG.Wait()
+
+	var rtt4, rtt6 time.Duration
+	if statistics4 != nil {
+		result.pingState4 = isAlive(statistics4, target.icmp)
+		rtt4 = statistics4.Avg()
+		if !result.pingState4 && tcpRtt > 0 && target.host == target.host4 {
+			result.pingState4, rtt4 = true, tcpRtt
+		}
+	}
+	if statistics6 != nil {
+		result.pingState6 = isAlive(statistics6, target.icmp)
+		rtt6 = statistics6.Avg()
+		if !result.pingState6 && tcpRtt > 0 && target.host == target.host6 {
+			result.pingState6, rtt6 = true, tcpRtt
+		}
+	}
+	switch target.prefer {
+	case ipPreferV6:
+		result.useIPv6 = statistics6 != nil
+	case ipPreferReachable:
+		result.useIPv6 = statistics4 == nil || (statistics6 != nil && !result.pingState4 && result.pingState6)
+	default:
+		result.useIPv6 = statistics4 == nil
+	}
+
+	statistics, newState, rtt := statistics4, result.pingState4, rtt4
+	if result.useIPv6 {
+		statistics, newState, rtt = statistics6, result.pingState6, rtt6
+	}
+	result.pingMS = formatMS(rtt)
+	result.pingMS4 = formatMS(rtt4)
+	result.pingMS6 = formatMS(rtt6)
+	if statistics != nil {
+		result.loss = strconv.FormatFloat(statistics.Loss(), 'f', 0, 64)
+		if len(statistics.rtts) > 0 {
+			result.jitter = formatMS(statistics.StdDev())
+			result.pingMin = formatMS(statistics.Min())
+			result.pingMax = formatMS(statistics.Max())
+		}
+	}
+	result.pingState = newState && (httpOK || !target.httpAlive)
+
+	done.result, done.alive, done.rtt = result, newState, rtt
+}
+
+// Apply results to servers under one lock, then one redraw if anything changed
+func (pg *pingWorker) commit(batch []probeDone) {
+	changed := false
 	pg.servers.L.Lock()
-	defer pg.servers.L.Unlock()
-	if item, ok := pg.servers.D[id]; ok {
-		item.pingState = newState
-		if newState {
-			item.pingMS = newPingMS
+	for idx := range batch {
+		done := &batch[idx]
+		item, ok := pg.servers.D[done.id]
+		if !ok {
+			continue
+		}
+		result := done.result
+		// keep last known ping
+		if !done.alive {
+			result.pingMS = item.pingMS
+		}
+		if !result.pingState4 {
+			result.pingMS4 = item.pingMS4
+		}
+		if !result.pingState6 {
+			result.pingMS6 = item.pingMS6
+		}
+		if !done.sshProbed {
+			result.sshFingerprint, result.sshChanged = item.sshFingerprint, item.sshChanged
+		}
+		oldSpark := item.history.Spark()
+		item.history.Add(done.rtt, done.alive)
+		healthChange := item.health.Update(result.pingState, done.upThreshold, done.downThreshold)
+		if !item.probeResult.equal(&result) || oldSpark != item.history.Spark() || healthChange {
+			item.probeResult = result
+			changed = true
+		}
+	}
+	pg.servers.L.Unlock()
+	if changed {
+		pg.redraw()
+	}
+}
+
+// Run prober from rules, or ICMP/TCP depends on probe mode
+func pingAny(ctx context.Context, target proberTarget, probe string) *proberResult {
+	name := probe
+	if name == probeTypeDefault {
+		name = probeTypeICMP
+		if mode, _ := getProbeMode(); mode == probeTCP {
+			name = probeTypeTCP
+		}
+	}
+	p := getProber(name)
+	if p == nil {
+		return &proberResult{sent: target.options.packets(), err: fmt.Errorf("Unknown prober %q", name)}
+	}
+	ctx, cancel := context.WithTimeout(ctx, target.options.deadline())
+	defer cancel()
+	result := p.Probe(ctx, target)
+	return &result
+}
+
+func isAlive(result *proberResult, options icmpOptions) bool {
+	return result.reachable && result.Loss() < options.lossThreshold
+}
+
+func formatMS(value time.Duration) string {
+	return strconv.FormatInt((value / time.Millisecond).Nanoseconds(), 10)
+}
+
+// TCP connect to all ports, return ports state and fastest connect time (0 if all closed)
+func probePorts(host string, ports []int, timeout time.Duration) ([]portState, time.Duration) {
+	result := make([]portState, len(ports))
+	rtts := make([]time.Duration, len(ports))
+	wg := sync.WaitGroup{}
+	for idx, port := range ports {
+		wg.Add(1)
+		go func(idx, port int) {
+			defer wg.Done()
+			result[idx].Port = port
+			start := time.Now()
+			conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(port)), timeout)
+			if err != nil {
+				return
+			}
+			rtts[idx] = time.Since(start)
+			result[idx].Open = true
+			conn.Close()
+		}(idx, port)
+	}
+	wg.Wait()
+
+	var rtt time.Duration
+	for _, value := range rtts {
+		if value > 0 && (rtt == 0 || value < rtt) {
+			rtt = value
 		}
-		pg.scalewayCFG(scalewayDrawSignal)
 	}
+	return result, rtt
 }
 
 func (pg *pingWorker) Quit() {
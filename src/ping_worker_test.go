@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Prober with scripted results, the last result repeats
+type fakeProber struct {
+	results map[string][]proberResult
+	L       sync.Mutex
+}
+
+func newFakeProber() *fakeProber {
+	return &fakeProber{results: map[string][]proberResult{}}
+}
+
+func (p *fakeProber) Push(host string, results ...proberResult) {
+	p.L.Lock()
+	p.results[host] = append(p.results[host], results...)
+	p.L.Unlock()
+}
+
+func (p *fakeProber) Probe(ctx context.Context, target proberTarget) proberResult {
+	p.L.Lock()
+	defer p.L.Unlock()
+	results := p.results[target.host]
+	if len(results) == 0 {
+		return proberResult{sent: target.options.packets(), err: errors.New("No fake result")}
+	}
+	result := results[0]
+	if len(results) > 1 {
+		p.results[target.host] = results[1:]
+	}
+	return result
+}
+
+var (
+	fakeUp   = proberResult{reachable: true, sent: 1, rtts: []time.Duration{time.Millisecond * 20}}
+	fakeDown = proberResult{sent: 1}
+)
+
+func TestHealthStateUpdate(t *testing.T) {
+	tests := []struct {
+		name     string
+		up, down int
+		alive    []bool
+		states   []aliveState
+	}{
+		{"first probe up", 1, 1, []bool{true}, []aliveState{aliveUp}},
+		{"first probe down", 1, 1, []bool{false}, []aliveState{aliveDown}},
+		{"no hysteresis", 1, 1, []bool{true, false, true}, []aliveState{aliveUp, aliveDown, aliveUp}},
+		{"degraded before down", 1, 3, []bool{true, false, false, false},
+			[]aliveState{aliveUp, aliveDegraded, aliveDegraded, aliveDown}},
+		{"degraded before up", 2, 1, []bool{false, true, true},
+			[]aliveState{aliveDown, aliveDegraded, aliveUp}},
+		{"success resets failures", 1, 2, []bool{true, false, true, false},
+			[]aliveState{aliveUp, aliveDegraded, aliveUp, aliveDegraded}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			health := healthState{}
+			for idx, alive := range test.alive {
+				old := health.state
+				changed := health.Update(alive, test.up, test.down)
+				if health.state != test.states[idx] {
+					t.Fatalf("probe %d: state %d, want %d", idx+1, health.state, test.states[idx])
+				}
+				if changed != (old != health.state) {
+					t.Fatalf("probe %d: changed %v for %d -> %d", idx+1, changed, old, health.state)
+				}
+			}
+		})
+	}
+}
+
+func TestPingWorkerCommit(t *testing.T) {
+	const host = "192.0.2.1"
+	tests := []struct {
+		name     string
+		up, down int
+		results  []proberResult
+		states   []aliveState
+	}{
+		{"up", 1, 1, []proberResult{fakeUp, fakeUp}, []aliveState{aliveUp, aliveUp}},
+		{"down and back", 2, 2,
+			[]proberResult{fakeUp, fakeDown, fakeDown, fakeUp, fakeUp},
+			[]aliveState{aliveUp, aliveDegraded, aliveDown, aliveDegraded, aliveUp}},
+		{"loss over threshold", 1, 1,
+			[]proberResult{{reachable: true, sent: 2, rtts: []time.Duration{time.Millisecond}}},
+			[]aliveState{aliveDown}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			prober := newFakeProber()
+			prober.Push(host, test.results...)
+			registerProber("fake", prober)
+
+			servers := &serversInfo{D: map[serverID]*serverInfo{}}
+			servers.D["1"] = &serverInfo{ID: "1", NAME: "web", IPv4: host, isIPv4: true}
+			servers.ServersList = []serverID{"1"}
+			redraws := 0
+			pg := newPingWorker(&settingsStorage{D: newDefaultSettingsData()}, servers, nil, func() { redraws++ })
+			target := probeTarget{id: "1", probe: "fake", host: host, host4: host}
+			target.icmp = icmpOptions{count: 1, timeout: time.Second, lossThreshold: 50}
+			target.upThreshold, target.downThreshold = test.up, test.down
+
+			for idx, want := range test.states {
+				pg.pingHost(target, time.Second)
+				pg.commit([]probeDone{<-pg.doneChan})
+				if state := servers.D["1"].health.state; state != want {
+					t.Fatalf("probe %d: state %d, want %d", idx+1, state, want)
+				}
+			}
+			if redraws == 0 {
+				t.Fatal("no redraw after changes")
+			}
+		})
+	}
+}
+
+// Rule target of absent tag renders empty, server must be skipped, not crash the worker
+func TestPingWorkerEmptyRuleTarget(t *testing.T) {
+	servers := &serversInfo{D: map[serverID]*serverInfo{}}
+	servers.D["1"] = &serverInfo{ID: "1", NAME: "web", IPv4: "192.0.2.1", isIPv4: true, tagMap: map[string]string{}}
+	servers.ServersList = []serverID{"1"}
+	cfg := newDefaultSettingsData()
+	cfg.ProbeRules = []*probeRule{{Name: "web", Target: "{TAG:probe}"}}
+	pg := newPingWorker(&settingsStorage{D: cfg}, servers, nil, func() {})
+
+	rule := cfg.probeRuleFor("1", "web", nil)
+	if target := newProbeTarget(cfg, "1", servers.D["1"], &rule); target.host != "" || target.host4 != "" || target.host6 != "" {
+		t.Fatalf("target of empty rule: %q %q %q", target.host, target.host4, target.host6)
+	}
+	pg.dispatch(1, true)
+	if pg.running["1"] {
+		t.Fatal("probe started for empty target")
+	}
+	if _, ok := pg.schedule["1"]; !ok {
+		t.Fatal("server with empty target is not rescheduled")
+	}
+
+	// no addresses at all
+	pg.pingHost(probeTarget{id: "1", icmp: icmpOptions{count: 1, timeout: time.Second}}, time.Second)
+	if done := <-pg.doneChan; done.alive || done.result.loss != "" {
+		t.Fatalf("result without hosts: alive %v, loss %q", done.alive, done.result.loss)
+	}
+}
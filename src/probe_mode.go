@@ -0,0 +1,60 @@
+package main
+
+import (
+	"runtime"
+	"sync"
+
+	"golang.org/x/net/icmp"
+)
+
+type probeMode uint8
+
+const (
+	probeICMPUnprivileged probeMode = iota
+	probeICMPPrivileged
+	probeTCP
+)
+
+func (m probeMode) String() string {
+	switch m {
+	case probeICMPUnprivileged:
+		return "ICMP (unprivileged)"
+	case probeICMPPrivileged:
+		return "ICMP (privileged)"
+	}
+	return "TCP"
+}
+
+var detectedMode struct {
+	once   sync.Once
+	mode   probeMode
+	reason string
+}
+
+// Detect which ping we can use. Result cached
+func getProbeMode() (probeMode, string) {
+	detectedMode.once.Do(func() {
+		detectedMode.mode, detectedMode.reason = detectProbeMode()
+	})
+	return detectedMode.mode, detectedMode.reason
+}
+
+func detectProbeMode() (probeMode, string) {
+	if runtime.GOOS == "windows" {
+		return probeICMPPrivileged, "Windows supports only privileged ICMP"
+	}
+	conn, errUnprivileged := icmp.ListenPacket("udp4", "0.0.0.0")
+	if errUnprivileged == nil {
+		conn.Close()
+		return probeICMPUnprivileged, "Unprivileged ICMP permitted"
+	}
+	conn, err := icmp.ListenPacket("ip4:icmp", "0.0.0.0")
+	if err == nil {
+		conn.Close()
+		return probeICMPPrivileged, "Unprivileged ICMP not permitted (" + errUnprivileged.Error() +
+			"), raw sockets allowed (CAP_NET_RAW)"
+	}
+	printErr("ICMP not permitted: %v; %v", errUnprivileged, err)
+	return probeTCP, "ICMP not permitted (" + errUnprivileged.Error() +
+		"), set net.ipv4.ping_group_range or CAP_NET_RAW"
+}
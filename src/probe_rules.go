@@ -0,0 +1,106 @@
+package main
+
+import (
+	"path"
+	"strings"
+)
+
+const (
+	probeTypeDefault = ""
+	probeTypeICMP    = "icmp"
+	probeTypeTCP     = "tcp"
+)
+
+// Override probe settings for matched servers
+type probeRule struct {
+	// All not empty must match
+	ServerID string `json:"server_id"`
+	// Glob, e.g. web-*
+	Name string `json:"name"`
+	Tag  string `json:"tag"`
+
+	// Zero values keep global settings
+	Probe string `json:"probe"`
+	// In sec
+	Interval int `json:"interval"`
+	Timeout  int `json:"timeout"`
+	// Template, e.g. {HOSTNAME}.example.com
+	Target string `json:"target"`
+	// Absent keeps earlier rules, false monitors again
+	Unmonitor *bool `json:"unmonitor,omitempty"`
+}
+
+func (r *probeRule) IsEmpty() bool {
+	return r.ServerID == "" && r.Name == "" && r.Tag == ""
+}
+
+func (r *probeRule) IsUnmonitored() bool {
+	return r.Unmonitor != nil && *r.Unmonitor
+}
+
+func (r *probeRule) Match(id, name string, tags []string) bool {
+	return matchServer(r.ServerID, r.Name, r.Tag, id, name, tags)
+}
+
+// All not empty selectors must match, empty rule matches nothing
+func matchServer(ruleID, ruleName, ruleTag string, id, name string, tags []string) bool {
+	if ruleID == "" && ruleName == "" && ruleTag == "" {
+		return false
+	}
+	if ruleID != "" && ruleID != id {
+		return false
+	}
+	if ruleName != "" {
+		if ok, err := path.Match(ruleName, name); err != nil || !ok {
+			return false
+		}
+	}
+	if ruleTag != "" && !matchTag(tags, ruleTag) {
+		return false
+	}
+	return true
+}
+
+// Title for GUI
+func (r *probeRule) String() string {
+	result := []string{}
+	if r.ServerID != "" {
+		result = append(result, "id="+r.ServerID)
+	}
+	if r.Name != "" {
+		result = append(result, "name="+r.Name)
+	}
+	if r.Tag != "" {
+		result = append(result, "tag="+r.Tag)
+	}
+	if len(result) == 0 {
+		return "<empty>"
+	}
+	return strings.Join(result, ", ")
+}
+
+// Merge all matched rules, later rules override earlier
+func (d *settingsData) probeRuleFor(id, name string, tags []string) probeRule {
+	result := probeRule{}
+	for _, rule := range d.ProbeRules {
+		if !rule.Match(id, name, tags) {
+			continue
+		}
+		if rule.Probe != probeTypeDefault {
+			result.Probe = rule.Probe
+		}
+		if rule.Interval > 0 {
+			result.Interval = rule.Interval
+		}
+		if rule.Timeout > 0 {
+			result.Timeout = rule.Timeout
+		}
+		if rule.Target != "" {
+			result.Target = rule.Target
+		}
+		if rule.Unmonitor != nil {
+			result.Unmonitor = rule.Unmonitor
+		}
+	}
+	return result
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProbeRuleFor(t *testing.T) {
+	yes, no := true, false
+	rules := []*probeRule{
+		{Tag: "internal", Unmonitor: &yes},
+		{Name: "web-*", Probe: "tcp", Interval: 30, Target: "{HOSTNAME}"},
+		{ServerID: "id-2", Unmonitor: &no, Timeout: 3},
+		{Name: "web-2", Interval: 60},
+		{Tag: "env=prod", Probe: "icmp"},
+	}
+	cfg := &settingsData{ProbeRules: rules}
+	tests := []struct {
+		id, name string
+		tags     []string
+		want     probeRule
+	}{
+		{"id-0", "db-1", nil, probeRule{}},
+		{"id-1", "db-1", []string{"internal"}, probeRule{Unmonitor: &yes}},
+		{"id-1", "web-1", nil, probeRule{Probe: "tcp", Interval: 30, Target: "{HOSTNAME}"}},
+		// later rule enables again
+		{"id-2", "db-2", []string{"internal"}, probeRule{Unmonitor: &no, Timeout: 3}},
+		// later rule without the field keeps it
+		{"id-3", "web-1", []string{"internal"}, probeRule{Probe: "tcp", Interval: 30, Target: "{HOSTNAME}", Unmonitor: &yes}},
+		{"id-2", "web-2", []string{"internal", "env=prod"}, probeRule{Probe: "icmp", Interval: 60, Timeout: 3, Target: "{HOSTNAME}", Unmonitor: &no}},
+	}
+	for _, test := range tests {
+		result := cfg.probeRuleFor(test.id, test.name, test.tags)
+		if !reflect.DeepEqual(result, test.want) {
+			t.Errorf("probeRuleFor(%s, %s, %v) = %+v, want %+v", test.id, test.name, test.tags, result, test.want)
+		}
+		if result.IsUnmonitored() != test.want.IsUnmonitored() {
+			t.Errorf("probeRuleFor(%s, %s, %v).IsUnmonitored() = %v", test.id, test.name, test.tags, result.IsUnmonitored())
+		}
+	}
+}
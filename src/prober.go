@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sparrc/go-ping"
+)
+
+// What to probe
+type proberTarget struct {
+	host string
+	// for TCP probe, tcpFallbackPorts if empty
+	ports   []int
+	options icmpOptions
+}
+
+// Result of one probe run
+type proberResult struct {
+	reachable bool
+	sent      int
+	rtts      []time.Duration
+	err       error
+}
+
+// Send packets to target, stop when ctx done
+type prober interface {
+	Probe(ctx context.Context, target proberTarget) proberResult
+}
+
+var proberRegistry = struct {
+	D map[string]prober
+	L sync.RWMutex
+}{D: map[string]prober{}}
+
+// Register prober by name, replace existing
+func registerProber(name string, p prober) {
+	proberRegistry.L.Lock()
+	proberRegistry.D[name] = p
+	proberRegistry.L.Unlock()
+}
+
+// nil if not registered
+func getProber(name string) prober {
+	proberRegistry.L.RLock()
+	defer proberRegistry.L.RUnlock()
+	return proberRegistry.D[name]
+}
+
+func proberNames() []string {
+	proberRegistry.L.RLock()
+	defer proberRegistry.L.RUnlock()
+	result := make([]string, 0, len(proberRegistry.D))
+	for name := range proberRegistry.D {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func init() {
+	registerProber(probeTypeICMP, &icmpProber{})
+	registerProber(probeTypeTCP, &tcpProber{})
+}
+
+// Max time of probe run
+func (o *icmpOptions) deadline() time.Duration {
+	timeout := o.timeout
+	if timeout <= 0 {
+		timeout = time.Second * 5
+	}
+	return timeout + time.Duration(o.packets())*o.interval
+}
+
+func (o *icmpOptions) packets() int {
+	if o.count < 1 {
+		return 1
+	}
+	return o.count
+}
+
+// Percent of lost packets
+func (r *proberResult) Loss() float64 {
+	if r.sent == 0 {
+		return 100
+	}
+	return float64(r.sent-len(r.rtts)) / float64(r.sent) * 100
+}
+
+func (r *proberResult) Min() time.Duration {
+	var result time.Duration
+	for idx, rtt := range r.rtts {
+		if idx == 0 || rtt < result {
+			result = rtt
+		}
+	}
+	return result
+}
+
+func (r *proberResult) Max() time.Duration {
+	var result time.Duration
+	for _, rtt := range r.rtts {
+		if rtt > result {
+			result = rtt
+		}
+	}
+	return result
+}
+
+func (r *proberResult) Avg() time.Duration {
+	if len(r.rtts) == 0 {
+		return 0
+	}
+	var sum time.Duration
+	for _, rtt := range r.rtts {
+		sum += rtt
+	}
+	return sum / time.Duration(len(r.rtts))
+}
+
+func (r *proberResult) StdDev() time.Duration {
+	if len(r.rtts) == 0 {
+		return 0
+	}
+	avg := r.Avg()
+	var deviation float64
+	for _, rtt := range r.rtts {
+		deviation += math.Pow(float64(rtt-avg), 2)
+	}
+	return time.Duration(math.Sqrt(deviation / float64(len(r.rtts))))
+}
+
+// ICMP echo with go-ping, privileged depends on probe mode
+type icmpProber struct{}
+
+func (p *icmpProber) Probe(ctx context.Context, target proberTarget) proberResult {
+	pinger, err := ping.NewPinger(target.host)
+	if err != nil {
+		printErr("NewPinger %s: %v", target.host, err)
+		return proberResult{sent: target.options.packets(), err: err}
+	}
+	mode, _ := getProbeMode()
+	pinger.SetPrivileged(mode == probeICMPPrivileged)
+	pinger.Count = target.options.packets()
+	if target.options.interval > 0 {
+		pinger.Interval = target.options.interval
+	}
+	pinger.Timeout = target.options.timeout
+	if pinger.Timeout <= 0 {
+		pinger.Timeout = time.Second * 5
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			pinger.Stop()
+		case <-done:
+		}
+	}()
+	pinger.Run()
+	close(done)
+	statistics := pinger.Statistics()
+	result := proberResult{sent: statistics.PacketsSent, rtts: statistics.Rtts, reachable: statistics.PacketsRecv > 0}
+	if result.sent < pinger.Count {
+		result.sent = pinger.Count
+	}
+	return result
+}
+
+// Ping with TCP connect if ICMP not permitted. Refused connection also means host is up
+type tcpProber struct{}
+
+func (p *tcpProber) Probe(ctx context.Context, target proberTarget) proberResult {
+	ports := target.ports
+	if len(ports) == 0 {
+		ports = tcpFallbackPorts
+	}
+	timeout := target.options.timeout
+	if timeout <= 0 {
+		timeout = time.Second * 5
+	}
+	result := proberResult{sent: target.options.packets()}
+	timeout /= time.Duration(result.sent)
+	dialer := net.Dialer{Timeout: timeout}
+	for idx := 0; idx < result.sent; idx++ {
+		if idx > 0 && target.options.interval > 0 {
+			select {
+			case <-ctx.Done():
+				result.err = ctx.Err()
+				return result
+			case <-time.After(target.options.interval):
+			}
+		}
+		for _, port := range ports {
+			start := time.Now()
+			conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(target.host, strconv.Itoa(port)))
+			if err == nil {
+				conn.Close()
+			}
+			if err == nil || isConnRefused(err) {
+				result.rtts = append(result.rtts, time.Since(start))
+				break
+			}
+			result.err = err
+		}
+	}
+	result.reachable = len(result.rtts) > 0
+	if result.reachable {
+		result.err = nil
+	}
+	return result
+}
+
+// Refused connect means host is up. Unwrap net.OpError and os.SyscallError
+func isConnRefused(err error) bool {
+	if opErr, ok := err.(*net.OpError); ok {
+		err = opErr.Err
+	}
+	if syscallErr, ok := err.(*os.SyscallError); ok {
+		err = syscallErr.Err
+	}
+	// 10061 is WSAECONNREFUSED of Windows
+	return err == syscall.ECONNREFUSED || err == syscall.Errno(10061)
+}
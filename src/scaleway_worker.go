@@ -3,6 +3,8 @@ package main
 import (
 	"fmt"
 	"os"
+	"sort"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -18,28 +20,52 @@ const (
 	scalewayUpdateSignal cfgActionID = iota
 	scalewayCFGSignal
 	scalewayMaskSignal
-	scalewayDrawSignal
 )
 
 type serverID string
 type serverInfo struct {
-	ID        string
-	NAME      string
-	IPv4      string
-	IPv6      string
-	STATE     string
-	REGION    string
-	isIPv4    bool
-	isIPv6    bool
-	pingState bool
-	pingMS    string
+	ID       string
+	NAME     string
+	HOSTNAME string
+	IPv4     string
+	IPv6     string
+	private  string
+	STATE    string
+	REGION   string
+	zone     utils.Zone
+	isIPv4   bool
+	isIPv6   bool
+	tags     []string
+	tagMap   map[string]string
+	created  time.Time
+	modified time.Time
+	// STATE change seen by app, first sight if not seen
+	stateSince time.Time
+	// kept between updates
+	probeResult
+	history latencyHistory
+	health  healthState
 }
 
 type serversInfo struct {
 	D map[serverID]*serverInfo
 	L sync.RWMutex
-	// for ID position saving
+	// for ID position saving, menu order after filter and grouping
 	ServersList []serverID
+	// all servers in API order
+	all []serverID
+}
+
+// Server from menu index, call under lock
+func (s *serversInfo) byIndex(idx int) (*serverInfo, error) {
+	if idx >= len(s.ServersList) || idx < 0 {
+		return nil, fmt.Errorf("Wrong menu index: %d", idx)
+	}
+	item, ok := s.D[s.ServersList[idx]]
+	if !ok {
+		panic(fmt.Errorf("serversInfo: Corrupted"))
+	}
+	return item, nil
 }
 
 type scalewayWorker struct {
@@ -48,6 +74,9 @@ type scalewayWorker struct {
 	menu        *menuPool
 	stopChan    chan os.Signal
 	signalsChan chan cfgActionID
+	refreshChan chan serverID
+	// pending redraw, never dropped
+	drawChan chan struct{}
 }
 
 func newScalewayWorker(config *settingsStorage, menu *menuPool) *scalewayWorker {
@@ -55,6 +84,8 @@ func newScalewayWorker(config *settingsStorage, menu *menuPool) *scalewayWorker
 	sw.servers = &serversInfo{D: map[serverID]*serverInfo{}, ServersList: []serverID{}}
 	sw.stopChan = make(chan os.Signal, 1)
 	sw.signalsChan = make(chan cfgActionID, 3)
+	sw.refreshChan = make(chan serverID, 10)
+	sw.drawChan = make(chan struct{}, 1)
 
 	sw.config = config
 	sw.menu = menu
@@ -68,7 +99,7 @@ func (sw *scalewayWorker) Start(firstRunCallback func()) {
 
 func (sw *scalewayWorker) loop(firstRunCallback func()) {
 	var timerChan <-chan time.Time
-	var oldmask string
+	var oldCopyNames string
 	var firstRun bool
 
 	var updateInterval time.Duration
@@ -89,14 +120,27 @@ func (sw *scalewayWorker) loop(firstRunCallback func()) {
 			timerChan = make(<-chan time.Time, 1)
 		}
 	}
+	// rules may change without global mask
 	maskChange := func() {
-		mask := sw.getViewMask()
-		if mask != oldmask {
-			oldmask = mask
-			sw.updateMenu(oldmask, false)
+		sw.config.L.RLock()
+		setDurationFormat(sw.config.D.DurationFormat)
+		setSymbols(newSymbolSet(sw.config.D.SymbolPreset, sw.config.D.Symbols))
+		filter, groupBy := sw.config.D.ServerFilter, sw.config.D.GroupByTag
+		sw.config.L.RUnlock()
+		sw.servers.L.Lock()
+		sizeChange := sw.servers.applyFilter(filter, groupBy)
+		sw.servers.L.Unlock()
+		sw.updateMenu(sw.getViewMask(), sizeChange)
+		sw.config.L.RLock()
+		names := sw.config.D.copyActionNames()
+		sw.config.L.RUnlock()
+		if joined := strings.Join(names, "\n"); joined != oldCopyNames {
+			oldCopyNames = joined
+			sw.menu.SetCopyActions(names)
 		}
 	}
 
+	maskChange()
 	initTimer()
 	makeTimer()
 	if firstRun {
@@ -111,21 +155,17 @@ func (sw *scalewayWorker) loop(firstRunCallback func()) {
 		select {
 		case <-sw.stopChan:
 			return
-		case <-time.After(time.Second * 1):
-			select {
-			case id := <-sw.signalsChan:
-				if id == scalewayDrawSignal {
-					sw.updateMenu(sw.getViewMask(), false)
-					break
-				}
-				if id == scalewayCFGSignal || id == scalewayUpdateSignal {
-					initTimer()
-					makeTimer()
-				}
-				if id == scalewayMaskSignal || id == scalewayUpdateSignal {
-					maskChange()
-				}
-			default:
+		case id := <-sw.refreshChan:
+			sw.updateServer(id)
+		case <-sw.drawChan:
+			sw.updateMenu(sw.getViewMask(), false)
+		case id := <-sw.signalsChan:
+			if id == scalewayCFGSignal || id == scalewayUpdateSignal {
+				initTimer()
+				makeTimer()
+			}
+			if id == scalewayMaskSignal || id == scalewayUpdateSignal {
+				maskChange()
 			}
 		case <-timerChan:
 			sw.updateScaleway()
@@ -138,8 +178,39 @@ func (sw *scalewayWorker) updateMenu(mask string, menuChange bool) {
 	if menuChange {
 		sw.menu.HideAll()
 	}
+	sw.config.L.RLock()
+	rules := sw.config.D.MaskRules
+	sw.config.L.RUnlock()
 	sw.servers.L.RLock()
 	defer sw.servers.L.RUnlock()
+	certWarn := []string{}
+	certErr := []string{}
+	sshWarn := []string{}
+	for _, id := range sw.servers.ServersList {
+		if item, ok := sw.servers.D[id]; ok {
+			if item.certWarn {
+				certWarn = append(certWarn, item.NAME)
+			}
+			if item.certStatus != "" {
+				certErr = append(certErr, item.NAME)
+			}
+			if item.sshChanged {
+				sshWarn = append(sshWarn, item.NAME)
+			}
+		}
+	}
+	warnings := []string{}
+	if len(certWarn) > 0 {
+		warnings = append(warnings, fmt.Sprintf("TLS certificate expires: %s", strings.Join(certWarn, ", ")))
+	}
+	if len(certErr) > 0 {
+		warnings = append(warnings, fmt.Sprintf("TLS check failed: %s", strings.Join(certErr, ", ")))
+	}
+	if len(sshWarn) > 0 {
+		warnings = append(warnings, fmt.Sprintf("SSH host key changed: %s", strings.Join(sshWarn, ", ")))
+	}
+	sw.menu.SetWarning(strings.Join(warnings, "\n"))
+
 	size := len(sw.servers.ServersList)
 	if size > sw.menu.GetSize() {
 		size = sw.menu.GetSize()
@@ -147,9 +218,12 @@ func (sw *scalewayWorker) updateMenu(mask string, menuChange bool) {
 	for idx := 0; idx < size; idx++ {
 		id := sw.servers.ServersList[idx]
 		if item, ok := sw.servers.D[id]; ok {
-			if ok = sw.menu.UpdateTitle(idx, fillView(mask, item), menuChange); !ok {
+			if ok = sw.menu.UpdateTitle(idx, fillView(rules.ViewMask(mask, item), item), menuChange); !ok {
 				panic(fmt.Errorf("menuPool: Corrupted"))
 			}
+			sw.menu.UpdateStatus(idx, item.statusLine())
+			sw.menu.SetActionVisible(idx, menuAcceptSSHKeyAction, item.sshChanged)
+			sw.menu.SetActionVisible(idx, menuKnownHostsAction, item.sshFingerprint != "")
 		} else {
 			panic(fmt.Errorf("serversInfo: Corrupted"))
 		}
@@ -157,14 +231,22 @@ func (sw *scalewayWorker) updateMenu(mask string, menuChange bool) {
 
 }
 
-func (sw *scalewayWorker) updateScaleway() {
+func (sw *scalewayWorker) newClient() (*scw.Client, error) {
 	sw.config.L.RLock()
-	client, err := scw.NewClient(
+	defer sw.config.L.RUnlock()
+	return newScalewayClient(sw.config.D)
+}
+
+func newScalewayClient(cfg *settingsData) (*scw.Client, error) {
+	return scw.NewClient(
 		// Get your credentials at https://console.scaleway.com/account/credentials
-		scw.WithDefaultProjectID(sw.config.D.OrganizationID),
-		scw.WithAuth(sw.config.D.AccessKey, sw.config.D.SecretKey),
+		scw.WithDefaultProjectID(cfg.OrganizationID),
+		scw.WithAuth(cfg.AccessKey, cfg.SecretKey),
 	)
-	sw.config.L.RUnlock()
+}
+
+func (sw *scalewayWorker) updateScaleway() {
+	client, err := sw.newClient()
 	if err != nil {
 		printErr("NewClient: %v", err)
 		return
@@ -177,6 +259,9 @@ func (sw *scalewayWorker) updateScaleway() {
 	for _, zone := range zones {
 		if response, err := instanceAPI.ListServers(&instance.ListServersRequest{Zone: zone}); err == nil {
 			all.TotalCount += response.TotalCount
+			for _, item := range response.Servers {
+				item.Zone = zone
+			}
 			all.Servers = append(all.Servers, response.Servers...)
 		} else {
 			printErr("ListServers %v: %v", zone, err)
@@ -185,6 +270,45 @@ func (sw *scalewayWorker) updateScaleway() {
 	sw.parseNewServers(all)
 }
 
+// Refresh only one server, e.g. after finished task
+func (sw *scalewayWorker) updateServer(id serverID) {
+	sw.servers.L.RLock()
+	var zone utils.Zone
+	old, ok := sw.servers.D[id]
+	if ok {
+		zone = old.zone
+	}
+	sw.servers.L.RUnlock()
+	if !ok {
+		return
+	}
+
+	client, err := sw.newClient()
+	if err != nil {
+		printErr("NewClient: %v", err)
+		return
+	}
+	response, err := instance.NewAPI(client).GetServer(&instance.GetServerRequest{Zone: zone, ServerID: string(id)})
+	if err != nil {
+		printErr("GetServer %s: %v", id, err)
+		return
+	}
+	response.Server.Zone = zone
+
+	filter, groupBy := sw.getServerFilter()
+	sizeChange := false
+	sw.servers.L.Lock()
+	if old, ok = sw.servers.D[id]; ok {
+		sw.servers.D[id] = newServerInfo(response.Server, old)
+		// tags may change
+		sizeChange = sw.servers.applyFilter(filter, groupBy)
+	}
+	sw.servers.L.Unlock()
+	if ok {
+		sw.updateMenu(sw.getViewMask(), sizeChange)
+	}
+}
+
 func (sw *scalewayWorker) parseNewServers(response *instance.ListServersResponse) {
 	servers := map[serverID]*serverInfo{}
 	serversList := []serverID{}
@@ -196,37 +320,150 @@ func (sw *scalewayWorker) parseNewServers(response *instance.ListServersResponse
 			continue
 		}
 		serversList = append(serversList, id)
-		servers[id] = &serverInfo{item.ID, item.Name, "IPv4", "IPv6", item.State.String(),
-			"REGION", false, false, false, "PING"}
-		if old, ok := sw.servers.D[id]; ok {
-			servers[id].REGION = old.REGION
-			servers[id].pingState = old.pingState
-			servers[id].pingMS = old.pingMS
-		}
-
-		if item.PublicIP != nil {
-			servers[id].IPv4 = item.PublicIP.Address.String()
-			servers[id].isIPv4 = true
-		}
-		if item.IPv6 != nil {
-			servers[id].IPv6 = item.IPv6.Address.String()
-			servers[id].isIPv6 = true
-		}
-		if item.Location != nil {
-			servers[id].REGION = item.Location.ZoneID
-		}
+		servers[id] = newServerInfo(item, sw.servers.D[id])
 	}
 	sw.servers.L.RUnlock()
 
+	filter, groupBy := sw.getServerFilter()
 	sw.servers.L.Lock()
-	sizeChange := len(sw.servers.ServersList) != len(serversList)
 	sw.servers.D = servers
-	sw.servers.ServersList = serversList
+	sw.servers.all = serversList
+	sizeChange := sw.servers.applyFilter(filter, groupBy)
 	sw.servers.L.Unlock()
 
 	sw.updateMenu(sw.getViewMask(), sizeChange)
 }
 
+// Filter and grouping settings of menu
+func (sw *scalewayWorker) getServerFilter() (string, string) {
+	sw.config.L.RLock()
+	defer sw.config.L.RUnlock()
+	return sw.config.D.ServerFilter, sw.config.D.GroupByTag
+}
+
+// Update menu order from filter and grouping, return true if size changed. Call under write lock
+func (s *serversInfo) applyFilter(filter, groupBy string) bool {
+	serversList := filterServers(s.all, s.D, filter, groupBy)
+	sizeChange := len(s.ServersList) != len(serversList)
+	s.ServersList = serversList
+	return sizeChange
+}
+
+// Make serverInfo from API data, old may be nil
+func newServerInfo(item *instance.Server, old *serverInfo) *serverInfo {
+	result := &serverInfo{
+		ID:       item.ID,
+		NAME:     item.Name,
+		HOSTNAME: item.Hostname,
+		IPv4:     "IPv4",
+		IPv6:     "IPv6",
+		STATE:    item.State.String(),
+		REGION:   "REGION",
+		zone:     item.Zone,
+		tags:     item.Tags,
+		tagMap:   parseTags(item.Tags),
+		created:  item.CreationDate,
+		modified: item.ModificationDate,
+	}
+	result.pingMS = "PING"
+	result.stateSince = time.Now()
+	if old != nil {
+		if old.STATE == result.STATE {
+			result.stateSince = old.stateSince
+		}
+		result.REGION = old.REGION
+		result.probeResult = old.probeResult
+		result.history = old.history
+		result.health = old.health
+	}
+
+	if item.PublicIP != nil {
+		result.IPv4 = item.PublicIP.Address.String()
+		result.isIPv4 = true
+	}
+	if item.IPv6 != nil {
+		result.IPv6 = item.IPv6.Address.String()
+		result.isIPv6 = true
+	}
+	if item.PrivateIP != nil {
+		result.private = *item.PrivateIP
+	}
+	if item.Location != nil {
+		result.REGION = item.Location.ZoneID
+	}
+	return result
+}
+
+// All known addresses
+func (s *serverInfo) addresses() []string {
+	result := []string{}
+	if s.isIPv4 {
+		result = append(result, s.IPv4)
+	}
+	if s.isIPv6 {
+		result = append(result, s.IPv6)
+	}
+	if s.private != "" {
+		result = append(result, s.private)
+	}
+	return result
+}
+
+// Problems from probes for menu, empty if all right
+func (s *serverInfo) statusLine() string {
+	result := []string{}
+	if s.certStatus != "" {
+		result = append(result, s.certStatus)
+	}
+	if s.dnsStatus != "" {
+		result = append(result, s.dnsStatus)
+	}
+	if s.sshChanged {
+		result = append(result, "SSH host key changed: "+s.sshFingerprint)
+	}
+	names := make([]string, 0, len(s.checks))
+	for name := range s.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if check := s.checks[name]; check.Status != checkOK {
+			result = append(result, fmt.Sprintf("%s: %s %s", name, check.StatusName(), check.Output))
+		}
+	}
+	return strings.Join(result, "; ")
+}
+
+// ServerAction run power action on server from menu index, return created task.
+func (sw *scalewayWorker) ServerAction(idx int, action instance.ServerAction) (*trackedTask, error) {
+	sw.servers.L.RLock()
+	if idx >= len(sw.servers.ServersList) || idx < 0 {
+		sw.servers.L.RUnlock()
+		return nil, fmt.Errorf("Wrong menu index: %d", idx)
+	}
+	item, ok := sw.servers.D[sw.servers.ServersList[idx]]
+	if !ok {
+		panic(fmt.Errorf("serversInfo: Corrupted"))
+	}
+	task := &trackedTask{server: serverID(item.ID), name: item.NAME, zone: item.zone, action: action}
+	sw.servers.L.RUnlock()
+
+	client, err := sw.newClient()
+	if err != nil {
+		return nil, fmt.Errorf("NewClient: %v", err)
+	}
+	response, err := instance.NewAPI(client).ServerAction(&instance.ServerActionRequest{
+		Zone:     task.zone,
+		ServerID: string(task.server),
+		Action:   action,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ServerAction %s %s: %v", action, task.name, err)
+	}
+	task.task = response.Task
+	return task, nil
+}
+
 func (sw *scalewayWorker) getViewMask() string {
 	sw.config.L.RLock()
 	mask := sw.config.D.ViewMask
@@ -247,3 +484,20 @@ func (sw *scalewayWorker) CFGChange(id cfgActionID) {
 	default:
 	}
 }
+
+// Redraw menu after servers change. Requests are coalesced:
+// if one is pending, it runs after the caller's change anyway
+func (sw *scalewayWorker) Redraw() {
+	select {
+	case sw.drawChan <- struct{}{}:
+	default:
+	}
+}
+
+// RefreshServer request update for one server from Scaleway
+func (sw *scalewayWorker) RefreshServer(id serverID) {
+	select {
+	case sw.refreshChan <- id:
+	default:
+	}
+}
@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"os/user"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/OpenPeeDeeP/xdg"
@@ -13,16 +16,200 @@ import (
 
 const cfgName = "settings.json"
 
+const (
+	ipPreferV4        = "v4"
+	ipPreferV6        = "v6"
+	ipPreferReachable = "reachable"
+)
+
+var ipPreferences = []string{ipPreferV4, ipPreferV6, ipPreferReachable}
+
 type settingsData struct {
 	OrganizationID string `json:"organization_id"`
 	AccessKey      string `json:"access_key"`
 	SecretKey      string `json:"secret_key"`
 
 	ViewMask string `json:"view_mask"`
-	CopyMask string `json:"copy_mask"`
+	// Only for migration to CopyActions
+	CopyMask    string        `json:"copy_mask,omitempty"`
+	CopyActions []*copyAction `json:"copy_actions"`
+	// Per server and per tag formats, the most specific wins
+	MaskRules maskRules `json:"mask_rules"`
+	// Comma separated tag selectors, menu shows servers matching any. Empty for all
+	ServerFilter string `json:"server_filter"`
+	// Tag key for ordering menu by its value, empty for API order
+	GroupByTag string `json:"group_by_tag"`
 
 	CheckInterval int `json:"check_interval"`
 	PingInterval  int `json:"ping_interval"`
+	// ICMP packets per probe, interval between packets in ms and probe timeout in sec
+	PingCount          int `json:"ping_count"`
+	PingPacketInterval int `json:"ping_packet_interval"`
+	PingTimeout        int `json:"ping_timeout"`
+	// Server is down if packet loss reach it, in percent
+	PingLossThreshold int `json:"ping_loss_threshold"`
+	// External commands as probes
+	ExternalChecks []*externalCheck `json:"external_checks"`
+	// Max commands at the same time
+	ExternalConcurrency int `json:"external_concurrency"`
+	// Max probes at the same time
+	ProbeConcurrency int `json:"probe_concurrency"`
+	// Per server and per tag probe settings
+	ProbeRules []*probeRule `json:"probe_rules"`
+	// Consecutive successful pings for up and failed for down, degraded between
+	UpThreshold   int `json:"up_threshold"`
+	DownThreshold int `json:"down_threshold"`
+	// Menu symbols: emoji, ascii or none, custom symbols override preset
+	SymbolPreset string     `json:"symbol_preset"`
+	Symbols      *symbolSet `json:"symbols"`
+	// For AGE, MODIFIED and SINCE: short, long, hours or days
+	DurationFormat string `json:"duration_format"`
+	// Address family for IPvX and ALIVE: v4, v6 or reachable
+	IPPreference string `json:"ip_preference"`
+
+	// TCP ports for probe, per tag and per server (ID or name) overrides global
+	TCPPorts         []int            `json:"tcp_ports"`
+	TCPPortsByTag    map[string][]int `json:"tcp_ports_by_tag"`
+	TCPPortsByServer map[string][]int `json:"tcp_ports_by_server"`
+
+	// HTTP(S) checks, per server (ID or name) overrides per tag
+	HTTPChecksByTag    map[string]*httpCheck `json:"http_checks_by_tag"`
+	HTTPChecksByServer map[string]*httpCheck `json:"http_checks_by_server"`
+	// Failed HTTP check mark server as down
+	HTTPAffectsAlive bool `json:"http_affects_alive"`
+
+	// TLS certificate checks, per server (ID or name) overrides per tag, per tag overrides global
+	TLSCheck          *tlsCheck            `json:"tls_check"`
+	TLSChecksByTag    map[string]*tlsCheck `json:"tls_checks_by_tag"`
+	TLSChecksByServer map[string]*tlsCheck `json:"tls_checks_by_server"`
+	// Warn if certificate expires in less days
+	TLSWarnDays int `json:"tls_warn_days"`
+
+	// DNS name template for DNS probe, per tag overrides global. Empty for disable
+	DNSTemplate       string            `json:"dns_template"`
+	DNSTemplatesByTag map[string]string `json:"dns_templates_by_tag"`
+	// host[:port], empty for system resolver
+	DNSResolver string `json:"dns_resolver"`
+
+	// SSH host key monitoring
+	SSHCheck bool `json:"ssh_check"`
+	SSHPort  int  `json:"ssh_port"`
+	// Seconds between SSH probes of server, also probed after state change
+	SSHInterval int `json:"ssh_interval"`
+	// Empty for ~/.ssh/known_hosts
+	KnownHosts string `json:"known_hosts"`
+}
+
+func (d *settingsData) knownHostsPath() string {
+	if d.KnownHosts != "" {
+		return d.KnownHosts
+	}
+	current, err := user.Current()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(current.HomeDir, ".ssh", "known_hosts")
+}
+
+// HTTP check: server rule, else first matched tag, nil if not configured
+func (d *settingsData) httpCheckFor(id, name string, tags []string) *httpCheck {
+	if check, ok := d.HTTPChecksByServer[id]; ok {
+		return check
+	}
+	if check, ok := d.HTTPChecksByServer[name]; ok {
+		return check
+	}
+	for _, tag := range tags {
+		if check, ok := d.HTTPChecksByTag[tag]; ok {
+			return check
+		}
+	}
+	return nil
+}
+
+// Ports for TCP probe: server rule, else all matched tags, else global
+func (d *settingsData) tcpPortsFor(id, name string, tags []string) []int {
+	if ports, ok := d.TCPPortsByServer[id]; ok {
+		return ports
+	}
+	if ports, ok := d.TCPPortsByServer[name]; ok {
+		return ports
+	}
+	var result []int
+	found := false
+	for _, tag := range tags {
+		if ports, ok := d.TCPPortsByTag[tag]; ok {
+			found = true
+			result = appendPorts(result, ports...)
+		}
+	}
+	if found {
+		return result
+	}
+	return d.TCPPorts
+}
+
+// TLS check: server rule, else first matched tag, else global. nil if not configured
+func (d *settingsData) tlsCheckFor(id, name string, tags []string) *tlsCheck {
+	if check, ok := d.TLSChecksByServer[id]; ok {
+		return check
+	}
+	if check, ok := d.TLSChecksByServer[name]; ok {
+		return check
+	}
+	for _, tag := range tags {
+		if check, ok := d.TLSChecksByTag[tag]; ok {
+			return check
+		}
+	}
+	return d.TLSCheck
+}
+
+// DNS name template: first matched tag, else global
+func (d *settingsData) dnsTemplateFor(tags []string) string {
+	for _, tag := range tags {
+		if template, ok := d.DNSTemplatesByTag[tag]; ok {
+			return template
+		}
+	}
+	return d.DNSTemplate
+}
+
+// Parse "22, 443" to ports list
+func parsePortsList(text string) ([]int, error) {
+	var result []int
+	for _, field := range strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == ' ' }) {
+		port, err := strconv.Atoi(field)
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("Wrong port: %s", field)
+		}
+		result = appendPorts(result, port)
+	}
+	return result, nil
+}
+
+func formatPortsList(ports []int) string {
+	result := make([]string, len(ports))
+	for idx, port := range ports {
+		result[idx] = strconv.Itoa(port)
+	}
+	return strings.Join(result, ", ")
+}
+
+func appendPorts(ports []int, add ...int) []int {
+	for _, port := range add {
+		exist := false
+		for _, old := range ports {
+			if old == port {
+				exist = true
+				break
+			}
+		}
+		if !exist {
+			ports = append(ports, port)
+		}
+	}
+	return ports
 }
 
 type settingsStorage struct {
@@ -74,9 +261,23 @@ func newSettingsStorage() *settingsStorage {
 func newDefaultSettingsData() *settingsData {
 	result := settingsData{}
 	result.ViewMask = "{ALIVE} {FLAG} {NAME} {IPvX} {STATE}"
-	result.CopyMask = "ssh root@{IPv4}"
+	result.CopyActions = defaultCopyActions()
 	result.CheckInterval = 1200
 	result.PingInterval = 10
+	result.PingCount = 1
+	result.PingPacketInterval = 1000
+	result.PingTimeout = 5
+	result.PingLossThreshold = 100
+	result.IPPreference = ipPreferV4
+	result.DurationFormat = durationShort
+	result.SymbolPreset = symbolsEmoji
+	result.UpThreshold = 1
+	result.DownThreshold = 1
+	result.SSHPort = 22
+	result.SSHInterval = 3600
+	result.ProbeConcurrency = 20
+	result.ExternalConcurrency = 4
+	result.TLSWarnDays = 14
 	return &result
 }
 
@@ -92,11 +293,15 @@ func loadFromFS(path string) (*settingsData, error) {
 	if err != nil {
 		return nil, fmt.Errorf("Error reading %s: %v", path, err)
 	}
-	result := settingsData{}
-	if err = json.Unmarshal(data, &result); err != nil {
+	// missing keys from old settings keep default values
+	result := newDefaultSettingsData()
+	result.CopyActions = nil
+	if err = json.Unmarshal(data, result); err != nil {
 		return nil, fmt.Errorf("JSON Unmarshal error %s: %v", path, err)
 	}
-	return &result, nil
+	result.migrateCopyMask()
+	result.MaskRules.validate()
+	return result, nil
 }
 
 func saveToFS(path string, data *settingsData) error {
@@ -9,20 +9,22 @@ import (
 )
 
 type settingsGUI struct {
-	config *settingsStorage
-	wait   Wait
+	config  *settingsStorage
+	servers *serversInfo
+	wait    Wait
 	// call when "Quit" clicked
 	quitCallback     func()
 	scalewayCallback func(cfgActionID)
 	pingCallback     func()
 	stopWait         sync.WaitGroup
 	// unsafe
-	_setter func()
+	_setters []func()
 }
 
-func newSettingsGUI(config *settingsStorage, scalewayCallback func(cfgActionID), pingCallback func(), quitCallback func()) *settingsGUI {
+func newSettingsGUI(config *settingsStorage, servers *serversInfo, scalewayCallback func(cfgActionID), pingCallback func(), quitCallback func()) *settingsGUI {
 	g := settingsGUI{}
 	g.config = config
+	g.servers = servers
 	g.scalewayCallback = scalewayCallback
 	g.pingCallback = pingCallback
 	g.quitCallback = quitCallback
@@ -46,14 +48,14 @@ var mainwin *ui.Window
 
 // Set gui values from settingsData
 func (g *settingsGUI) callSetter() {
-	if g._setter != nil {
-		g._setter()
+	for _, setter := range g._setters {
+		setter()
 	}
 }
 
 // Call where mainwin is destroy - unlink all gui method and mark gui as "Closed"
 func (g *settingsGUI) clearALL() {
-	g._setter = nil
+	g._setters = nil
 	g.wait.Clear()
 }
 
@@ -101,9 +103,15 @@ func (g *settingsGUI) showGUI() {
 	tab.Append("Settings", g.makeTabSettings())
 	tab.SetMargined(0, true)
 
-	tab.Append("Info", g.makeInfoSettings())
+	tab.Append("Probes", g.makeTabProbes())
 	tab.SetMargined(1, true)
 
+	tab.Append("Copy", g.makeTabCopy())
+	tab.SetMargined(2, true)
+
+	tab.Append("Info", g.makeInfoSettings())
+	tab.SetMargined(3, true)
+
 	box.Append(g.makeButtonsSettings(), true)
 
 	mainwin.Show()
@@ -124,18 +132,87 @@ func (g *settingsGUI) makeTabSettings() ui.Control {
 	form.Append("Secret Key", elSecretKey, false)
 	form.Append("", ui.NewLabel(""), false)
 
+	elPreviewServer, previewServer := g.makePreviewSelector()
 	elMenuMask := ui.NewEntry()
-	elCopyMask := ui.NewEntry()
+	elMenuPreview := ui.NewLabel("")
+	form.Append("Preview for", elPreviewServer, false)
 	form.Append("Menu format", elMenuMask, false)
-	form.Append("Copy format", elCopyMask, false)
+	form.Append("", elMenuPreview, false)
+	elDurationFormat := ui.NewCombobox()
+	for _, value := range durationFormats {
+		elDurationFormat.Append(value)
+	}
+	form.Append("Durations", elDurationFormat, false)
+	elSymbolPreset := ui.NewCombobox()
+	for _, value := range symbolPresets {
+		elSymbolPreset.Append(value)
+	}
+	form.Append("Symbols", elSymbolPreset, false)
+	elServerFilter := ui.NewEntry()
+	elGroupByTag := ui.NewEntry()
+	form.Append("Server filter", elServerFilter, false)
+	form.Append("Group by tag", elGroupByTag, false)
 	form.Append("", ui.NewLabel(""), false)
+	updatePreview := func() {
+		elMenuPreview.SetText(previewMask(elMenuMask.Text(), previewServer(), true, escapeNone, g.previewStyle()))
+	}
 
 	elCheckInterval := ui.NewSpinbox(0, 3600*24*30)
 	elPingInterval := ui.NewSpinbox(0, 3600*24*30)
 	form.Append("Check interval", elCheckInterval, false)
 	form.Append("Ping interval", elPingInterval, false)
 
-	g._setter = func() {
+	elPingCount := ui.NewSpinbox(1, 100)
+	elPingPacketInterval := ui.NewSpinbox(10, 60000)
+	elPingTimeout := ui.NewSpinbox(1, 600)
+	elPingLossThreshold := ui.NewSpinbox(1, 100)
+	form.Append("Ping packets", elPingCount, false)
+	form.Append("Packet interval, ms", elPingPacketInterval, false)
+	form.Append("Ping timeout", elPingTimeout, false)
+	form.Append("Down at loss, %", elPingLossThreshold, false)
+
+	elProbeConcurrency := ui.NewSpinbox(1, 1000)
+	form.Append("Parallel probes", elProbeConcurrency, false)
+	elExternalConcurrency := ui.NewSpinbox(1, 100)
+	form.Append("Parallel commands", elExternalConcurrency, false)
+
+	elUpThreshold := ui.NewSpinbox(1, 100)
+	elDownThreshold := ui.NewSpinbox(1, 100)
+	form.Append("Up after successes", elUpThreshold, false)
+	form.Append("Down after failures", elDownThreshold, false)
+
+	elIPPreference := ui.NewCombobox()
+	for _, value := range ipPreferences {
+		elIPPreference.Append(value)
+	}
+	form.Append("Prefer IP", elIPPreference, false)
+
+	elTCPPorts := ui.NewEntry()
+	form.Append("TCP ports", elTCPPorts, false)
+
+	elHTTPAffectsAlive := ui.NewCheckbox("Failed HTTP check means down")
+	form.Append("", elHTTPAffectsAlive, false)
+
+	elTLSWarnDays := ui.NewSpinbox(0, 365)
+	form.Append("TLS warn days", elTLSWarnDays, false)
+
+	elDNSTemplate := ui.NewEntry()
+	elDNSResolver := ui.NewEntry()
+	form.Append("DNS name", elDNSTemplate, false)
+	form.Append("DNS resolver", elDNSResolver, false)
+
+	elSSHCheck := ui.NewCheckbox("Monitor SSH host keys")
+	elSSHPort := ui.NewSpinbox(1, 65535)
+	elSSHInterval := ui.NewSpinbox(60, 3600*24*30)
+	elKnownHosts := ui.NewEntry()
+	form.Append("", elSSHCheck, false)
+	form.Append("SSH port", elSSHPort, false)
+	form.Append("SSH check interval", elSSHInterval, false)
+	form.Append("known_hosts file", elKnownHosts, false)
+
+	setter := func() {
+		// preview reads settings, so after unlock
+		defer updatePreview()
 		g.config.L.RLock()
 		defer g.config.L.RUnlock()
 
@@ -144,11 +221,33 @@ func (g *settingsGUI) makeTabSettings() ui.Control {
 		elSecretKey.SetText(g.config.D.SecretKey)
 
 		elMenuMask.SetText(g.config.D.ViewMask)
-		elCopyMask.SetText(g.config.D.CopyMask)
 
 		elCheckInterval.SetValue(g.config.D.CheckInterval)
 		elPingInterval.SetValue(g.config.D.PingInterval)
+		elPingCount.SetValue(g.config.D.PingCount)
+		elPingPacketInterval.SetValue(g.config.D.PingPacketInterval)
+		elPingTimeout.SetValue(g.config.D.PingTimeout)
+		elPingLossThreshold.SetValue(g.config.D.PingLossThreshold)
+		elProbeConcurrency.SetValue(g.config.D.ProbeConcurrency)
+		elExternalConcurrency.SetValue(g.config.D.ExternalConcurrency)
+		elUpThreshold.SetValue(g.config.D.UpThreshold)
+		elDownThreshold.SetValue(g.config.D.DownThreshold)
+		elIPPreference.SetSelected(indexOf(ipPreferences, g.config.D.IPPreference))
+		elDurationFormat.SetSelected(indexOf(durationFormats, g.config.D.DurationFormat))
+		elSymbolPreset.SetSelected(indexOf(symbolPresets, g.config.D.SymbolPreset))
+		elServerFilter.SetText(g.config.D.ServerFilter)
+		elGroupByTag.SetText(g.config.D.GroupByTag)
+		elTCPPorts.SetText(formatPortsList(g.config.D.TCPPorts))
+		elHTTPAffectsAlive.SetChecked(g.config.D.HTTPAffectsAlive)
+		elTLSWarnDays.SetValue(g.config.D.TLSWarnDays)
+		elDNSTemplate.SetText(g.config.D.DNSTemplate)
+		elDNSResolver.SetText(g.config.D.DNSResolver)
+		elSSHCheck.SetChecked(g.config.D.SSHCheck)
+		elSSHPort.SetValue(g.config.D.SSHPort)
+		elSSHInterval.SetValue(g.config.D.SSHInterval)
+		elKnownHosts.SetText(g.config.D.knownHostsPath())
 	}
+	g._setters = append(g._setters, setter)
 
 	elOrganizationID.OnChanged(func(*ui.Entry) {
 		g.config.L.Lock()
@@ -169,16 +268,32 @@ func (g *settingsGUI) makeTabSettings() ui.Control {
 		g.scalewayCallback(scalewayCFGSignal)
 	})
 
+	elPreviewServer.OnSelected(func(*ui.Combobox) {
+		updatePreview()
+	})
+	// Broken templates aren't saved
 	elMenuMask.OnChanged(func(*ui.Entry) {
+		updatePreview()
+		if validateMask(elMenuMask.Text(), true) != nil {
+			return
+		}
 		g.config.L.Lock()
 		defer g.config.L.Unlock()
 		g.config.D.ViewMask = elMenuMask.Text()
 		g.scalewayCallback(scalewayMaskSignal)
 	})
-	elCopyMask.OnChanged(func(*ui.Entry) {
+
+	elServerFilter.OnChanged(func(*ui.Entry) {
 		g.config.L.Lock()
 		defer g.config.L.Unlock()
-		g.config.D.CopyMask = elCopyMask.Text()
+		g.config.D.ServerFilter = elServerFilter.Text()
+		g.scalewayCallback(scalewayMaskSignal)
+	})
+	elGroupByTag.OnChanged(func(*ui.Entry) {
+		g.config.L.Lock()
+		defer g.config.L.Unlock()
+		g.config.D.GroupByTag = elGroupByTag.Text()
+		g.scalewayCallback(scalewayMaskSignal)
 	})
 
 	elCheckInterval.OnChanged(func(*ui.Spinbox) {
@@ -194,7 +309,138 @@ func (g *settingsGUI) makeTabSettings() ui.Control {
 		g.pingCallback()
 	})
 
-	g.callSetter()
+	elPingCount.OnChanged(func(*ui.Spinbox) {
+		g.config.L.Lock()
+		defer g.config.L.Unlock()
+		g.config.D.PingCount = elPingCount.Value()
+		g.pingCallback()
+	})
+	elPingPacketInterval.OnChanged(func(*ui.Spinbox) {
+		g.config.L.Lock()
+		defer g.config.L.Unlock()
+		g.config.D.PingPacketInterval = elPingPacketInterval.Value()
+		g.pingCallback()
+	})
+	elPingTimeout.OnChanged(func(*ui.Spinbox) {
+		g.config.L.Lock()
+		defer g.config.L.Unlock()
+		g.config.D.PingTimeout = elPingTimeout.Value()
+		g.pingCallback()
+	})
+	elPingLossThreshold.OnChanged(func(*ui.Spinbox) {
+		g.config.L.Lock()
+		defer g.config.L.Unlock()
+		g.config.D.PingLossThreshold = elPingLossThreshold.Value()
+		g.pingCallback()
+	})
+	elProbeConcurrency.OnChanged(func(*ui.Spinbox) {
+		g.config.L.Lock()
+		defer g.config.L.Unlock()
+		g.config.D.ProbeConcurrency = elProbeConcurrency.Value()
+		g.pingCallback()
+	})
+	elExternalConcurrency.OnChanged(func(*ui.Spinbox) {
+		g.config.L.Lock()
+		defer g.config.L.Unlock()
+		g.config.D.ExternalConcurrency = elExternalConcurrency.Value()
+		g.pingCallback()
+	})
+	elUpThreshold.OnChanged(func(*ui.Spinbox) {
+		g.config.L.Lock()
+		defer g.config.L.Unlock()
+		g.config.D.UpThreshold = elUpThreshold.Value()
+	})
+	elDownThreshold.OnChanged(func(*ui.Spinbox) {
+		g.config.L.Lock()
+		defer g.config.L.Unlock()
+		g.config.D.DownThreshold = elDownThreshold.Value()
+	})
+	elDurationFormat.OnSelected(func(*ui.Combobox) {
+		if idx := elDurationFormat.Selected(); idx >= 0 {
+			g.config.L.Lock()
+			g.config.D.DurationFormat = durationFormats[idx]
+			g.config.L.Unlock()
+			g.scalewayCallback(scalewayMaskSignal)
+			updatePreview()
+		}
+	})
+	elSymbolPreset.OnSelected(func(*ui.Combobox) {
+		if idx := elSymbolPreset.Selected(); idx >= 0 {
+			g.config.L.Lock()
+			g.config.D.SymbolPreset = symbolPresets[idx]
+			g.config.L.Unlock()
+			g.scalewayCallback(scalewayMaskSignal)
+			updatePreview()
+		}
+	})
+	elIPPreference.OnSelected(func(*ui.Combobox) {
+		if idx := elIPPreference.Selected(); idx >= 0 {
+			g.config.L.Lock()
+			defer g.config.L.Unlock()
+			g.config.D.IPPreference = ipPreferences[idx]
+			g.pingCallback()
+		}
+	})
+	elTCPPorts.OnChanged(func(*ui.Entry) {
+		ports, err := parsePortsList(elTCPPorts.Text())
+		if err != nil {
+			return
+		}
+		g.config.L.Lock()
+		defer g.config.L.Unlock()
+		g.config.D.TCPPorts = ports
+		g.pingCallback()
+	})
+	elHTTPAffectsAlive.OnToggled(func(*ui.Checkbox) {
+		g.config.L.Lock()
+		defer g.config.L.Unlock()
+		g.config.D.HTTPAffectsAlive = elHTTPAffectsAlive.Checked()
+		g.pingCallback()
+	})
+	elTLSWarnDays.OnChanged(func(*ui.Spinbox) {
+		g.config.L.Lock()
+		defer g.config.L.Unlock()
+		g.config.D.TLSWarnDays = elTLSWarnDays.Value()
+		g.pingCallback()
+	})
+
+	elDNSTemplate.OnChanged(func(*ui.Entry) {
+		g.config.L.Lock()
+		defer g.config.L.Unlock()
+		g.config.D.DNSTemplate = elDNSTemplate.Text()
+		g.pingCallback()
+	})
+	elDNSResolver.OnChanged(func(*ui.Entry) {
+		g.config.L.Lock()
+		defer g.config.L.Unlock()
+		g.config.D.DNSResolver = elDNSResolver.Text()
+		g.pingCallback()
+	})
+	elSSHCheck.OnToggled(func(*ui.Checkbox) {
+		g.config.L.Lock()
+		defer g.config.L.Unlock()
+		g.config.D.SSHCheck = elSSHCheck.Checked()
+		g.pingCallback()
+	})
+	elSSHPort.OnChanged(func(*ui.Spinbox) {
+		g.config.L.Lock()
+		defer g.config.L.Unlock()
+		g.config.D.SSHPort = elSSHPort.Value()
+		g.pingCallback()
+	})
+	elSSHInterval.OnChanged(func(*ui.Spinbox) {
+		g.config.L.Lock()
+		defer g.config.L.Unlock()
+		g.config.D.SSHInterval = elSSHInterval.Value()
+		g.pingCallback()
+	})
+	elKnownHosts.OnChanged(func(*ui.Entry) {
+		g.config.L.Lock()
+		defer g.config.L.Unlock()
+		g.config.D.KnownHosts = elKnownHosts.Text()
+	})
+
+	setter()
 	return vbox
 }
 
@@ -264,6 +510,9 @@ func (g *settingsGUI) makeInfoSettings() ui.Control {
 	label("Build date", BuildDate)
 	label("OS", runtime.GOOS+", "+runtime.GOARCH)
 	label("Build", runtime.Compiler+","+runtime.Version())
+	mode, reason := getProbeMode()
+	label("Probe mode", mode.String())
+	label("", reason)
 
 	return vbox
 }
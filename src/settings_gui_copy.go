@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/andlabs/ui"
+)
+
+func (g *settingsGUI) makeTabCopy() ui.Control {
+	vbox := ui.NewVerticalBox()
+	vbox.SetPadded(true)
+
+	vbox.Append(ui.NewLabel(fmt.Sprintf("Copy actions in server submenu, up to %d. name: title; mask: template;\n"+
+		"default: action for click on server, the first if none; escape: shell, url or json for values.", copySlots)), false)
+	elActions := ui.NewMultilineEntry()
+	vbox.Append(elActions, true)
+
+	hbox := ui.NewHorizontalBox()
+	hbox.SetPadded(true)
+	hbox.Append(ui.NewLabel("Preview for"), false)
+	elPreviewServer, previewServer := g.makePreviewSelector()
+	hbox.Append(elPreviewServer, true)
+	vbox.Append(hbox, false)
+	elPreview := ui.NewMultilineEntry()
+	elPreview.SetReadOnly(true)
+	vbox.Append(elPreview, true)
+
+	// last valid actions
+	var current []*copyAction
+	preview := func() {
+		item := previewServer()
+		style := g.previewStyle()
+		result := []string{}
+		for _, action := range current {
+			name := action.Name
+			if action.Default {
+				name += " (default)"
+			}
+			result = append(result, name+": "+previewMask(action.Mask, item, false, action.Escape, style))
+		}
+		elPreview.SetText(strings.Join(result, "\n"))
+	}
+
+	setter := func() {
+		g.config.L.RLock()
+		current = g.config.D.CopyActions
+		data, err := json.MarshalIndent(current, "", "    ")
+		g.config.L.RUnlock()
+		if err != nil {
+			data = []byte(err.Error())
+		}
+		elActions.SetText(string(data))
+		preview()
+	}
+	g._setters = append(g._setters, setter)
+
+	elPreviewServer.OnSelected(func(*ui.Combobox) {
+		preview()
+	})
+	// Invalid actions aren't saved
+	elActions.OnChanged(func(*ui.MultilineEntry) {
+		actions := []*copyAction{}
+		if text := strings.TrimSpace(elActions.Text()); text != "" && text != "null" {
+			if err := json.Unmarshal([]byte(text), &actions); err != nil {
+				elPreview.SetText(fmt.Sprintf("JSON error: %v", err))
+				return
+			}
+		}
+		if err := validateCopyActions(actions); err != nil {
+			elPreview.SetText(err.Error())
+			return
+		}
+		current = actions
+		g.config.L.Lock()
+		g.config.D.CopyActions = actions
+		g.config.L.Unlock()
+		g.scalewayCallback(scalewayMaskSignal)
+		preview()
+	})
+
+	setter()
+	return vbox
+}
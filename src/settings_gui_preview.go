@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/andlabs/ui"
+)
+
+// Preview server selector. Servers are listed when window opens
+func (g *settingsGUI) makePreviewSelector() (*ui.Combobox, func() *serverInfo) {
+	elServer := ui.NewCombobox()
+	elServer.Append("Sample data")
+	g.servers.L.RLock()
+	ids := append([]serverID{}, g.servers.ServersList...)
+	for _, id := range ids {
+		elServer.Append(g.servers.D[id].NAME)
+	}
+	g.servers.L.RUnlock()
+	elServer.SetSelected(0)
+
+	// copy of server, or sample if it's gone
+	selected := func() *serverInfo {
+		idx := elServer.Selected() - 1
+		if idx < 0 || idx >= len(ids) {
+			return sampleServerInfo()
+		}
+		g.servers.L.RLock()
+		defer g.servers.L.RUnlock()
+		if item, ok := g.servers.D[ids[idx]]; ok {
+			copied := *item
+			return &copied
+		}
+		return sampleServerInfo()
+	}
+	return elServer, selected
+}
+
+// Style from settings, worker may not apply it yet
+func (g *settingsGUI) previewStyle() *maskStyle {
+	g.config.L.RLock()
+	defer g.config.L.RUnlock()
+	return &maskStyle{
+		duration: g.config.D.DurationFormat,
+		symbols:  newSymbolSet(g.config.D.SymbolPreset, g.config.D.Symbols),
+	}
+}
+
+// Rendered mask, or error and unknown keys
+func previewMask(mask string, item *serverInfo, view bool, escapeMode string, style *maskStyle) string {
+	if err := validateMask(mask, view); err != nil {
+		return "Error: " + err.Error()
+	}
+	result, err := executeMaskStyle(mask, item, view, escapeMode, style)
+	if err != nil {
+		return "Error: " + err.Error()
+	}
+	if unknown := unknownMaskKeys(mask, item, view); len(unknown) > 0 {
+		result += "\nUnknown keys: " + strings.Join(unknown, ", ")
+	}
+	return result
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/andlabs/ui"
+)
+
+func (g *settingsGUI) makeTabProbes() ui.Control {
+	vbox := ui.NewVerticalBox()
+	vbox.SetPadded(true)
+
+	vbox.Append(ui.NewLabel("Rules match servers by server_id, name (glob) and tag, later rules override earlier.\n"+
+		"probe: "+strings.Join(proberNames(), ", ")+"; interval, timeout: sec; target: template; unmonitor: don't probe."), false)
+	elRules := ui.NewMultilineEntry()
+	vbox.Append(elRules, true)
+	vbox.Append(ui.NewLabel("Preview"), false)
+	elPreview := ui.NewMultilineEntry()
+	elPreview.SetReadOnly(true)
+	vbox.Append(elPreview, true)
+
+	preview := func(rules []*probeRule) {
+		elPreview.SetText(g.previewProbeRules(rules))
+	}
+
+	setter := func() {
+		g.config.L.RLock()
+		rules := g.config.D.ProbeRules
+		data, err := json.MarshalIndent(rules, "", "    ")
+		g.config.L.RUnlock()
+		if err != nil {
+			data = []byte(err.Error())
+		}
+		elRules.SetText(string(data))
+		preview(rules)
+	}
+	g._setters = append(g._setters, setter)
+
+	elRules.OnChanged(func(*ui.MultilineEntry) {
+		rules := []*probeRule{}
+		if text := strings.TrimSpace(elRules.Text()); text != "" && text != "null" {
+			if err := json.Unmarshal([]byte(text), &rules); err != nil {
+				elPreview.SetText(fmt.Sprintf("JSON error: %v", err))
+				return
+			}
+		}
+		for idx, rule := range rules {
+			if rule.Probe != probeTypeDefault && getProber(rule.Probe) == nil {
+				elPreview.SetText(fmt.Sprintf("Rule %d: wrong probe %q", idx+1, rule.Probe))
+				return
+			}
+		}
+		g.config.L.Lock()
+		g.config.D.ProbeRules = rules
+		g.config.L.Unlock()
+		g.pingCallback()
+		preview(rules)
+	})
+
+	setter()
+	return vbox
+}
+
+// Matched servers for each rule
+func (g *settingsGUI) previewProbeRules(rules []*probeRule) string {
+	g.servers.L.RLock()
+	defer g.servers.L.RUnlock()
+	result := []string{}
+	for idx, rule := range rules {
+		names := []string{}
+		for _, id := range g.servers.ServersList {
+			if item, ok := g.servers.D[id]; ok && rule.Match(item.ID, item.NAME, item.tags) {
+				names = append(names, item.NAME)
+			}
+		}
+		if len(names) == 0 {
+			names = append(names, "-")
+		}
+		result = append(result, fmt.Sprintf("%d. %s: %s", idx+1, rule, strings.Join(names, ", ")))
+	}
+	return strings.Join(result, "\n")
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/andlabs/ui"
+	"github.com/atotto/clipboard"
+)
+
+// ShowTraceroute open window and run traceroute to host. Hops appear as they arrive
+func (g *settingsGUI) ShowTraceroute(name, host string) {
+	ui.QueueMain(func() {
+		g.showTraceroute(name, host)
+	})
+}
+
+func (g *settingsGUI) showTraceroute(name, host string) {
+	win := ui.NewWindow(fmt.Sprintf("Traceroute %s (%s)", name, host), 64, 48, true)
+	win.SetMargined(true)
+	box := ui.NewVerticalBox()
+	box.SetPadded(true)
+	win.SetChild(box)
+
+	elOutput := ui.NewNonWrappingMultilineEntry()
+	elOutput.SetReadOnly(true)
+	box.Append(elOutput, true)
+
+	hbox := ui.NewHorizontalBox()
+	hbox.SetPadded(true)
+	elStatus := ui.NewLabel("Running...")
+	hbox.Append(elStatus, true)
+	btCopy := ui.NewButton("Copy")
+	btCopy.OnClicked(func(*ui.Button) {
+		if err := clipboard.WriteAll(elOutput.Text()); err != nil {
+			printErr("WriteToClipboard: %v", err)
+		}
+	})
+	hbox.Append(btCopy, false)
+	box.Append(hbox, false)
+
+	// Window controls are destroyed on close, drop late hops and stop trace
+	ctx, cancel := context.WithCancel(context.Background())
+	var closedL sync.Mutex
+	closed := false
+	win.OnClosing(func(*ui.Window) bool {
+		closedL.Lock()
+		closed = true
+		closedL.Unlock()
+		cancel()
+		return true
+	})
+	queue := func(f func()) {
+		ui.QueueMain(func() {
+			closedL.Lock()
+			defer closedL.Unlock()
+			if !closed {
+				f()
+			}
+		})
+	}
+
+	win.Show()
+	go func() {
+		defer cancel()
+		err := traceroute(ctx, host, func(hop *traceHop) {
+			line := hop.String() + "\n"
+			queue(func() {
+				elOutput.Append(line)
+			})
+		})
+		queue(func() {
+			if err != nil {
+				elStatus.SetText(fmt.Sprintf("Error: %v", err))
+			} else {
+				elStatus.SetText("Done")
+			}
+		})
+	}()
+}
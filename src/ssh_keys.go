@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OpenPeeDeeP/xdg"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const sshKeysName = "ssh_keys.json"
+
+var errGotHostKey = errors.New("got host key")
+
+type sshKeyEntry struct {
+	Name string `json:"name"`
+	// authorized_keys format
+	Key string `json:"key"`
+	// New key, wait for accept
+	NewKey string `json:"new_key,omitempty"`
+}
+
+// Host keys of servers, saved near settings.json
+type sshKeyStore struct {
+	D map[serverID]*sshKeyEntry
+	L sync.Mutex
+}
+
+func newSSHKeyStore() *sshKeyStore {
+	store := sshKeyStore{D: map[serverID]*sshKeyEntry{}}
+	if path := xdg.New("", appName).QueryConfig(sshKeysName); path != "" {
+		if data, err := ioutil.ReadFile(path); err == nil {
+			if err = json.Unmarshal(data, &store.D); err != nil {
+				printErr("JSON Unmarshal error %s: %v", path, err)
+			}
+		}
+	}
+	return &store
+}
+
+// Save to ssh_keys.json
+func (s *sshKeyStore) Save() error {
+	s.L.Lock()
+	defer s.L.Unlock()
+	cfgHome := xdg.New("", appName).ConfigHome()
+	if err := os.Mkdir(cfgHome, 0700); err != nil && !os.IsExist(err) {
+		return err
+	}
+	path := filepath.Join(cfgHome, sshKeysName)
+	result, err := json.MarshalIndent(s.D, "", "    ")
+	if err != nil {
+		return fmt.Errorf("JSON Marshal error: %v", err)
+	}
+	if err = ioutil.WriteFile(path, result, 0600); err != nil {
+		err = fmt.Errorf("Saving error %s: %v", path, err)
+	}
+	return err
+}
+
+// Check remember key on first contact. Return fingerprint of current key and true if key changed
+func (s *sshKeyStore) Check(id serverID, name string, key ssh.PublicKey) (string, bool) {
+	authorized := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+	s.L.Lock()
+	entry, ok := s.D[id]
+	changed := false
+	if !ok {
+		s.D[id] = &sshKeyEntry{Name: name, Key: authorized}
+	} else if entry.Key == authorized {
+		entry.NewKey = ""
+	} else {
+		entry.NewKey = authorized
+		changed = true
+	}
+	s.L.Unlock()
+	if !ok {
+		if err := s.Save(); err != nil {
+			printErr("ssh keys save: %v", err)
+		}
+	}
+	return ssh.FingerprintSHA256(key), changed
+}
+
+// Accept new key of server
+func (s *sshKeyStore) Accept(id serverID) error {
+	s.L.Lock()
+	entry, ok := s.D[id]
+	if !ok || entry.NewKey == "" {
+		s.L.Unlock()
+		return fmt.Errorf("No new key for %s", id)
+	}
+	entry.Key, entry.NewKey = entry.NewKey, ""
+	s.L.Unlock()
+	return s.Save()
+}
+
+// Get current key
+func (s *sshKeyStore) Get(id serverID) (ssh.PublicKey, error) {
+	s.L.Lock()
+	entry, ok := s.D[id]
+	s.L.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("No key for %s", id)
+	}
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(entry.Key))
+	return key, err
+}
+
+// Connect and get host key without authentication
+func getSSHHostKey(address string, timeout time.Duration) (ssh.PublicKey, error) {
+	var result ssh.PublicKey
+	config := &ssh.ClientConfig{
+		User: "scaleway-tray",
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			result = key
+			return errGotHostKey
+		},
+		Timeout: timeout,
+	}
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+	_, _, _, err = ssh.NewClientConn(conn, address, config)
+	if result != nil {
+		return result, nil
+	}
+	if err == nil {
+		err = fmt.Errorf("No host key")
+	}
+	return nil, err
+}
+
+// Replace entries for hosts in known_hosts file. Hashed entries are kept
+func writeKnownHosts(path string, hosts []string, key ssh.PublicKey) error {
+	normalized := make([]string, len(hosts))
+	for idx, host := range hosts {
+		normalized[idx] = knownhosts.Normalize(host)
+	}
+	lines := []string{}
+	if file, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if !knownHostsMatch(line, normalized) {
+				lines = append(lines, line)
+			}
+		}
+		file.Close()
+		if err = scanner.Err(); err != nil {
+			return fmt.Errorf("Error reading %s: %v", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("Error reading %s: %v", path, err)
+	}
+	lines = append(lines, knownhosts.Line(hosts, key))
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		return fmt.Errorf("Saving error %s: %v", path, err)
+	}
+	return nil
+}
+
+func knownHostsMatch(line string, hosts []string) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+		return false
+	}
+	patterns := fields[0]
+	if strings.HasPrefix(patterns, "@") && len(fields) > 1 {
+		patterns = fields[1]
+	}
+	for _, pattern := range strings.Split(patterns, ",") {
+		if indexOf(hosts, pattern) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func sshAddress(host string, port int) string {
+	if port == 0 {
+		port = 22
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// Accept new host key of server from menu index
+func acceptSSHKey(idx int, srv *serversInfo, store *sshKeyStore) error {
+	srv.L.Lock()
+	defer srv.L.Unlock()
+	item, err := srv.byIndex(idx)
+	if err != nil {
+		return err
+	}
+	if err = store.Accept(serverID(item.ID)); err == nil {
+		item.sshChanged = false
+	}
+	return err
+}
+
+// Write host key of server from menu index to known_hosts
+func writeServerKnownHosts(idx int, cfg *settingsStorage, srv *serversInfo, store *sshKeyStore) error {
+	cfg.L.RLock()
+	path := cfg.D.knownHostsPath()
+	port := cfg.D.SSHPort
+	cfg.L.RUnlock()
+	if path == "" {
+		return fmt.Errorf("known_hosts path not set")
+	}
+
+	srv.L.RLock()
+	item, err := srv.byIndex(idx)
+	if err != nil {
+		srv.L.RUnlock()
+		return err
+	}
+	id := serverID(item.ID)
+	hosts := []string{}
+	if item.isIPv4 {
+		hosts = append(hosts, sshAddress(item.IPv4, port))
+	}
+	if item.isIPv6 {
+		hosts = append(hosts, sshAddress(item.IPv6, port))
+	}
+	srv.L.RUnlock()
+
+	if len(hosts) == 0 {
+		return fmt.Errorf("No addresses for %s", id)
+	}
+	key, err := store.Get(id)
+	if err != nil {
+		return err
+	}
+	return writeKnownHosts(path, hosts, key)
+}
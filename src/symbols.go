@@ -0,0 +1,205 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+)
+
+// Symbol presets
+const (
+	symbolsEmoji = "emoji"
+	symbolsASCII = "ascii"
+	symbolsNone  = "none"
+)
+
+var symbolPresets = []string{symbolsEmoji, symbolsASCII, symbolsNone}
+
+type latencyBucket struct {
+	// Latency less than, in ms
+	Below  int    `json:"below"`
+	Symbol string `json:"symbol"`
+}
+
+// Symbols for menu. Empty fields of custom set keep preset values
+type symbolSet struct {
+	Up       string `json:"up"`
+	Down     string `json:"down"`
+	Degraded string `json:"degraded"`
+	Unknown  string `json:"unknown"`
+	Warning  string `json:"warning"`
+	// By STATE value, for {STATE_ICON}
+	States       map[string]string `json:"states"`
+	StateDefault string            `json:"state_default"`
+	// Ascending, for {LATENCY_ICON}
+	Latency     []latencyBucket `json:"latency"`
+	LatencySlow string          `json:"latency_slow"`
+	// By region, for {FLAG}
+	Flags       map[string]string `json:"flags"`
+	FlagDefault string            `json:"flag_default"`
+}
+
+func newSymbolPreset(name string) *symbolSet {
+	switch name {
+	case symbolsASCII:
+		return &symbolSet{
+			Up: "[+]", Down: "[-]", Degraded: "[~]", Unknown: "[?]", Warning: "!",
+			States: map[string]string{
+				"running": ">", "stopped": ".", "stopped in place": "=",
+				"starting": "^", "stopping": "v", "locked": "#",
+			},
+			StateDefault: "?",
+			Latency:      []latencyBucket{{50, "+"}, {150, "~"}},
+			LatencySlow:  "!",
+			Flags:        map[string]string{"par1": "FR", "ams1": "NL"},
+			FlagDefault:  "--",
+		}
+	case symbolsNone:
+		return &symbolSet{}
+	}
+	return &symbolSet{
+		Up: pingOK, Down: pingERR, Degraded: pingDEG, Unknown: checkUNK, Warning: warning,
+		States: map[string]string{
+			"running": "\U0001F7E2", "stopped": "\U000026AB", "stopped in place": "\U000023F8",
+			"starting": "\U0001F504", "stopping": "\U0001F504", "locked": "\U0001F512",
+		},
+		StateDefault: checkUNK,
+		Latency:      []latencyBucket{{50, "\U0001F7E2"}, {150, "\U0001F7E1"}},
+		LatencySlow:  "\U0001F534",
+		Flags:        map[string]string{"par1": flagFR, "ams1": flagNL},
+		FlagDefault:  flagUG,
+	}
+}
+
+// Preset with custom overrides
+func newSymbolSet(preset string, custom *symbolSet) *symbolSet {
+	result := newSymbolPreset(preset)
+	if custom == nil {
+		return result
+	}
+	for _, field := range []struct{ dst, src *string }{
+		{&result.Up, &custom.Up},
+		{&result.Down, &custom.Down},
+		{&result.Degraded, &custom.Degraded},
+		{&result.Unknown, &custom.Unknown},
+		{&result.Warning, &custom.Warning},
+		{&result.StateDefault, &custom.StateDefault},
+		{&result.LatencySlow, &custom.LatencySlow},
+		{&result.FlagDefault, &custom.FlagDefault},
+	} {
+		if *field.src != "" {
+			*field.dst = *field.src
+		}
+	}
+	if len(custom.Latency) > 0 {
+		result.Latency = custom.Latency
+	}
+	result.States = mergeSymbols(result.States, custom.States)
+	result.Flags = mergeSymbols(result.Flags, custom.Flags)
+	return result
+}
+
+func mergeSymbols(base, custom map[string]string) map[string]string {
+	result := map[string]string{}
+	for key, value := range base {
+		result[key] = value
+	}
+	for key, value := range custom {
+		result[key] = value
+	}
+	return result
+}
+
+// For copy templates
+var emojiSymbols = newSymbolPreset(symbolsEmoji)
+
+// Set by scaleway worker from settings, templates haven't access to settings
+var activeSymbols = struct {
+	D *symbolSet
+	L sync.RWMutex
+}{D: newSymbolPreset(symbolsEmoji)}
+
+func setSymbols(symbols *symbolSet) {
+	activeSymbols.L.Lock()
+	activeSymbols.D = symbols
+	activeSymbols.L.Unlock()
+}
+
+func getSymbols() *symbolSet {
+	activeSymbols.L.RLock()
+	defer activeSymbols.L.RUnlock()
+	return activeSymbols.D
+}
+
+// Empty if server hasn't address
+func (s *symbolSet) alive(exist, alive bool) string {
+	if !exist {
+		return ""
+	}
+	if alive {
+		return s.Up
+	}
+	return s.Down
+}
+
+func (s *symbolSet) health(state aliveState) string {
+	switch state {
+	case aliveUp:
+		return s.Up
+	case aliveDegraded:
+		return s.Degraded
+	case aliveDown:
+		return s.Down
+	}
+	return s.Unknown
+}
+
+func (s *symbolSet) check(status int) string {
+	switch status {
+	case checkOK:
+		return s.Up
+	case checkWarning:
+		return s.Degraded
+	case checkCritical:
+		return s.Down
+	}
+	return s.Unknown
+}
+
+// pingOK and pingERR of probe results to symbols
+func (s *symbolSet) result(value string) string {
+	switch value {
+	case pingOK:
+		return s.Up
+	case pingERR:
+		return s.Down
+	}
+	return value
+}
+
+func (s *symbolSet) state(value string) string {
+	if symbol, ok := s.States[value]; ok {
+		return symbol
+	}
+	return s.StateDefault
+}
+
+func (s *symbolSet) flag(region string) string {
+	if symbol, ok := s.Flags[region]; ok {
+		return symbol
+	}
+	return s.FlagDefault
+}
+
+// Empty if ping unknown or failed
+func (s *symbolSet) latency(alive bool, ms string) string {
+	value, err := strconv.Atoi(ms)
+	if !alive || err != nil {
+		return ""
+	}
+	for _, bucket := range s.Latency {
+		if value < bucket.Below {
+			return bucket.Symbol
+		}
+	}
+	return s.LatencySlow
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// Tags as map: "env=prod" is env: prod, flag "web" is web: ""
+func parseTags(tags []string) map[string]string {
+	result := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		key, value := tag, ""
+		if pos := strings.Index(tag, "="); pos > 0 {
+			key, value = tag[:pos], tag[pos+1:]
+		}
+		if _, ok := result[key]; !ok {
+			result[key] = value
+		}
+	}
+	return result
+}
+
+// Selector "web" matches tag web or web=any, "env=prod" matches value, value can be glob
+func matchTag(tags []string, selector string) bool {
+	if indexOf(tags, selector) >= 0 {
+		return true
+	}
+	key, pattern := selector, ""
+	pos := strings.Index(selector, "=")
+	if pos > 0 {
+		key, pattern = selector[:pos], selector[pos+1:]
+	}
+	value, ok := parseTags(tags)[key]
+	if !ok {
+		return false
+	}
+	if pos <= 0 {
+		return true
+	}
+	matched, err := path.Match(pattern, value)
+	return err == nil && matched
+}
+
+// Servers of menu: matched by any of comma separated selectors, grouped by value of tag key.
+// Servers without the tag are last, order inside group is kept
+func filterServers(all []serverID, servers map[serverID]*serverInfo, filter, groupBy string) []serverID {
+	selectors := []string{}
+	for _, selector := range strings.Split(filter, ",") {
+		if selector = strings.TrimSpace(selector); selector != "" {
+			selectors = append(selectors, selector)
+		}
+	}
+	result := make([]serverID, 0, len(all))
+	for _, id := range all {
+		item, ok := servers[id]
+		if !ok {
+			continue
+		}
+		matched := len(selectors) == 0
+		for _, selector := range selectors {
+			if matchTag(item.tags, selector) {
+				matched = true
+				break
+			}
+		}
+		if matched {
+			result = append(result, id)
+		}
+	}
+	if groupBy = strings.TrimSpace(groupBy); groupBy == "" {
+		return result
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		a, aOK := servers[result[i]].tagMap[groupBy]
+		b, bOK := servers[result[j]].tagMap[groupBy]
+		if aOK != bOK {
+			return aOK
+		}
+		return a < b
+	})
+	return result
+}
+
+// Value of {TAG:key|default}
+func tagValue(tagMap map[string]string, key string) string {
+	def := ""
+	if pos := strings.Index(key, "|"); pos >= 0 {
+		key, def = key[:pos], key[pos+1:]
+	}
+	if value, ok := tagMap[key]; ok && value != "" {
+		return value
+	}
+	return def
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFilterServers(t *testing.T) {
+	servers := map[serverID]*serverInfo{}
+	add := func(id serverID, tags ...string) {
+		servers[id] = &serverInfo{ID: string(id), tags: tags, tagMap: parseTags(tags)}
+	}
+	add("a", "env=prod", "web")
+	add("b", "env=staging")
+	add("c", "db")
+	add("d", "env=prod", "db")
+	all := []serverID{"a", "b", "c", "d", "gone"}
+
+	tests := []struct {
+		filter, groupBy string
+		want            []serverID
+	}{
+		{"", "", []serverID{"a", "b", "c", "d"}},
+		{"env=prod", "", []serverID{"a", "d"}},
+		{"web, env=stag*", "", []serverID{"a", "b"}},
+		{"env", "", []serverID{"a", "b", "d"}},
+		{"nothing", "", []serverID{}},
+		{"", "env", []serverID{"a", "d", "b", "c"}},
+		{"db", " env ", []serverID{"d", "c"}},
+	}
+	for _, test := range tests {
+		if result := filterServers(all, servers, test.filter, test.groupBy); !reflect.DeepEqual(result, test.want) {
+			t.Errorf("filterServers(%q, %q) = %v, want %v", test.filter, test.groupBy, result, test.want)
+		}
+	}
+}
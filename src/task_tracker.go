@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/getlantern/systray"
+	"github.com/scaleway/scaleway-sdk-go/api/instance/v1"
+	"github.com/scaleway/scaleway-sdk-go/scw"
+	"github.com/scaleway/scaleway-sdk-go/utils"
+)
+
+const (
+	taskPollInterval = time.Second * 2
+	// Stop polling if task hangs
+	taskMaxAge = time.Minute * 15
+)
+
+const (
+	taskRunning = "\U000023F3"
+	taskOK      = pingOK
+	taskERR     = pingERR
+)
+
+type trackedTask struct {
+	task   *instance.Task
+	server serverID
+	name   string
+	zone   utils.Zone
+	action instance.ServerAction
+	added  time.Time
+	err    error
+}
+
+func (t *trackedTask) isFinished() bool {
+	if t.err != nil || t.task == nil {
+		return true
+	}
+	return t.task.Status == instance.TaskStatusSuccess || t.task.Status == instance.TaskStatusFailure
+}
+
+func (t *trackedTask) String() string {
+	switch {
+	case t.err != nil:
+		return fmt.Sprintf("%s %s %s: %v", taskERR, t.action, t.name, t.err)
+	case t.task == nil:
+		return fmt.Sprintf("%s %s %s", taskERR, t.action, t.name)
+	case t.task.Status == instance.TaskStatusSuccess:
+		return fmt.Sprintf("%s %s %s: %s", taskOK, t.action, t.name, t.task.Status)
+	case t.task.Status == instance.TaskStatusFailure:
+		return fmt.Sprintf("%s %s %s: %s", taskERR, t.action, t.name, t.task.Status)
+	}
+	return fmt.Sprintf("%s %s %s: %s %d%%", taskRunning, t.action, t.name, t.task.Status, t.task.Progress)
+}
+
+type taskTracker struct {
+	config    *settingsStorage
+	refresh   func(serverID)
+	stopChan  chan os.Signal
+	trackChan chan *trackedTask
+	// tasks, newest first
+	tasks []*trackedTask
+	L     sync.Mutex
+	// read-only
+	_root  *systray.MenuItem
+	_items []*systray.MenuItem
+}
+
+func newTaskTracker(config *settingsStorage, root *systray.MenuItem, size int, refresh func(serverID)) *taskTracker {
+	tt := taskTracker{}
+	tt.stopChan = make(chan os.Signal, 1)
+	tt.trackChan = make(chan *trackedTask, 10)
+
+	tt.config = config
+	tt.refresh = refresh
+	tt._root = root
+	tt._items = make([]*systray.MenuItem, size)
+	for idx := range tt._items {
+		tt._items[idx] = root.AddSubMenuItem("", "")
+		tt._items[idx].Disable()
+		tt._items[idx].Hide()
+	}
+	root.Disable()
+	return &tt
+}
+
+func (tt *taskTracker) Start() {
+	go tt.loop()
+}
+
+func (tt *taskTracker) loop() {
+	var timerChan <-chan time.Time
+	makeTimer := func() {
+		if tt.inFlight() {
+			timerChan = time.After(taskPollInterval)
+		} else {
+			timerChan = make(<-chan time.Time, 1)
+		}
+	}
+	makeTimer()
+
+	for {
+		select {
+		case <-tt.stopChan:
+			return
+		case task := <-tt.trackChan:
+			tt.add(task)
+			makeTimer()
+		case <-timerChan:
+			tt.poll()
+			makeTimer()
+		}
+	}
+}
+
+func (tt *taskTracker) add(task *trackedTask) {
+	task.added = time.Now()
+	tt.L.Lock()
+	tt.tasks = append([]*trackedTask{task}, tt.tasks...)
+	if len(tt.tasks) > len(tt._items) {
+		tt.tasks = tt.tasks[:len(tt._items)]
+	}
+	tt.L.Unlock()
+	if task.isFinished() {
+		tt.refresh(task.server)
+	}
+	tt.updateMenu()
+}
+
+func (tt *taskTracker) inFlight() bool {
+	tt.L.Lock()
+	defer tt.L.Unlock()
+	for _, task := range tt.tasks {
+		if !task.isFinished() {
+			return true
+		}
+	}
+	return false
+}
+
+// Update all running tasks and refresh servers where tasks ended
+func (tt *taskTracker) poll() {
+	tt.L.Lock()
+	running := []*trackedTask{}
+	for _, task := range tt.tasks {
+		if !task.isFinished() {
+			running = append(running, task)
+		}
+	}
+	tt.L.Unlock()
+	if len(running) == 0 {
+		return
+	}
+
+	tt.config.L.RLock()
+	client, err := newScalewayClient(tt.config.D)
+	tt.config.L.RUnlock()
+	if err != nil {
+		printErr("NewClient: %v", err)
+		return
+	}
+
+	for _, task := range running {
+		newTask, err := getTask(client, task.zone, task.task.ID)
+		tt.L.Lock()
+		if err != nil {
+			printErr("GetTask %s: %v", task.task.ID, err)
+			if time.Since(task.added) > taskMaxAge {
+				task.err = err
+			}
+		} else {
+			task.task = newTask
+			if !task.isFinished() && time.Since(task.added) > taskMaxAge {
+				task.err = fmt.Errorf("timeout")
+			}
+		}
+		finished := task.isFinished()
+		tt.L.Unlock()
+		if finished {
+			tt.refresh(task.server)
+		}
+	}
+	tt.updateMenu()
+}
+
+func (tt *taskTracker) updateMenu() {
+	tt.L.Lock()
+	defer tt.L.Unlock()
+	running := 0
+	for idx, item := range tt._items {
+		if idx < len(tt.tasks) {
+			if !tt.tasks[idx].isFinished() {
+				running++
+			}
+			item.SetTitle(tt.tasks[idx].String())
+			item.Show()
+		} else {
+			item.Hide()
+		}
+	}
+	if running > 0 {
+		tt._root.SetTitle(fmt.Sprintf("Tasks (%d)", running))
+	} else {
+		tt._root.SetTitle("Tasks")
+	}
+	if len(tt.tasks) > 0 {
+		tt._root.Enable()
+	}
+}
+
+// The SDK has no method for tasks
+func getTask(client *scw.Client, zone utils.Zone, id string) (*instance.Task, error) {
+	response := struct {
+		Task *instance.Task `json:"task"`
+	}{}
+	err := client.Do(&scw.ScalewayRequest{
+		Method: "GET",
+		Path:   "/instance/v1/zones/" + string(zone) + "/tasks/" + id,
+	}, &response)
+	if err == nil && response.Task == nil {
+		err = fmt.Errorf("Empty response")
+	}
+	return response.Task, err
+}
+
+// Track task until completion
+func (tt *taskTracker) Track(task *trackedTask) {
+	select {
+	case tt.trackChan <- task:
+	default:
+		printErr("Track task: queue is full, %s of %s is not tracked", task.action, task.name)
+	}
+}
+
+func (tt *taskTracker) Quit() {
+	select {
+	case tt.stopChan <- syscall.SIGTERM:
+	default:
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"time"
+)
+
+type tlsCheck struct {
+	// Template, e.g. {IPv4}:443
+	Address string `json:"address"`
+	// Template for SNI, e.g. {HOSTNAME}.example.com. Empty for none
+	SNI string `json:"sni"`
+	// In sec, 0 for 5
+	Timeout int `json:"timeout"`
+}
+
+type certInfo struct {
+	NotAfter time.Time
+	Issuer   string
+}
+
+// Days before expiry, negative if expired
+func (c *certInfo) Days() int {
+	return int(time.Until(c.NotAfter).Hours() / 24)
+}
+
+// Connect and read leaf certificate. Certificate not verified, we only want the expiry
+func checkTLS(check *tlsCheck, address, sni string) (*certInfo, error) {
+	timeout := time.Second * 5
+	if check.Timeout > 0 {
+		timeout = time.Second * time.Duration(check.Timeout)
+	}
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", address, &tls.Config{
+		ServerName:         sni,
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("No certificates")
+	}
+	return &certInfo{NotAfter: certs[0].NotAfter, Issuer: certs[0].Issuer.CommonName}, nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	traceMaxHops = 30
+	// Probes per hop
+	traceProbes  = 3
+	traceTimeout = time.Second * 2
+)
+
+type traceHop struct {
+	TTL int
+	// empty if no answer
+	Addr    string
+	RTTs    []time.Duration
+	Reached bool
+}
+
+func (h *traceHop) String() string {
+	result := []string{fmt.Sprintf("%2d", h.TTL)}
+	if h.Addr == "" {
+		result = append(result, "*")
+	} else {
+		result = append(result, h.Addr)
+		if names, err := net.LookupAddr(h.Addr); err == nil && len(names) > 0 {
+			result = append(result, "("+strings.TrimSuffix(names[0], ".")+")")
+		}
+	}
+	for _, rtt := range h.RTTs {
+		if rtt < 0 {
+			result = append(result, "*")
+		} else {
+			result = append(result, fmt.Sprintf("%.3f ms", float64(rtt)/float64(time.Millisecond)))
+		}
+	}
+	return strings.Join(result, "  ")
+}
+
+// Call onHop for each hop until target or ctx is done. Use raw ICMP if possible, else unprivileged fallback
+func traceroute(ctx context.Context, host string, onHop func(*traceHop)) error {
+	addr, err := net.ResolveIPAddr("ip", host)
+	if err != nil {
+		return err
+	}
+	isIPv6 := addr.IP.To4() == nil
+	network := "ip4:icmp"
+	if isIPv6 {
+		network = "ip6:ipv6-icmp"
+	}
+	conn, err := icmp.ListenPacket(network, "")
+	if err != nil {
+		return tracerouteUnprivileged(ctx, addr.IP, onHop)
+	}
+	defer conn.Close()
+	return traceICMP(ctx, conn, addr.IP, false, onHop)
+}
+
+// ICMP echo with growing TTL. conn is raw or datagram ICMP socket
+func traceICMP(ctx context.Context, conn *icmp.PacketConn, dst net.IP, datagram bool, onHop func(*traceHop)) error {
+	isIPv6 := dst.To4() == nil
+	var dstAddr net.Addr = &net.IPAddr{IP: dst}
+	if datagram {
+		dstAddr = &net.UDPAddr{IP: dst}
+	}
+	// close unblocks waiting for reply
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-finished:
+		}
+	}()
+	id := os.Getpid() & 0xffff
+	ids := []int{id}
+	// datagram socket may set ID to its local port
+	if addr, ok := conn.LocalAddr().(*net.UDPAddr); ok && datagram && addr.Port != 0 {
+		ids = append(ids, addr.Port&0xffff)
+	}
+	seq := 0
+	buf := make([]byte, 1500)
+	for ttl := 1; ttl <= traceMaxHops; ttl++ {
+		var err error
+		if isIPv6 {
+			err = conn.IPv6PacketConn().SetHopLimit(ttl)
+		} else {
+			err = conn.IPv4PacketConn().SetTTL(ttl)
+		}
+		if err != nil {
+			return err
+		}
+		hop := &traceHop{TTL: ttl}
+		for probe := 0; probe < traceProbes; probe++ {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			seq++
+			msg := icmp.Message{Body: &icmp.Echo{ID: id, Seq: seq, Data: []byte(appName)}}
+			msg.Type = ipv4.ICMPTypeEcho
+			if isIPv6 {
+				msg.Type = ipv6.ICMPTypeEchoRequest
+			}
+			data, err := msg.Marshal(nil)
+			if err != nil {
+				return err
+			}
+			start := time.Now()
+			if _, err = conn.WriteTo(data, dstAddr); err != nil {
+				return err
+			}
+			peer, reached, ok := readICMPReply(conn, buf, ids, seq, isIPv6, start.Add(traceTimeout))
+			if !ok {
+				hop.RTTs = append(hop.RTTs, -1)
+				continue
+			}
+			hop.RTTs = append(hop.RTTs, time.Since(start))
+			hop.Addr = peer
+			hop.Reached = hop.Reached || reached
+		}
+		// last probe may be cut by cancel
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		onHop(hop)
+		if hop.Reached {
+			return nil
+		}
+	}
+	return nil
+}
+
+// Wait reply for seq with echo ID from ids, other pings on host use the same seqs
+func readICMPReply(conn *icmp.PacketConn, buf []byte, ids []int, seq int, isIPv6 bool, deadline time.Time) (string, bool, bool) {
+	proto := 1
+	if isIPv6 {
+		proto = 58
+	}
+	if err := conn.SetReadDeadline(deadline); err != nil {
+		return "", false, false
+	}
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			return "", false, false
+		}
+		msg, err := icmp.ParseMessage(proto, buf[:n])
+		if err != nil {
+			continue
+		}
+		peerIP := peer.String()
+		if addr, ok := peer.(*net.UDPAddr); ok {
+			peerIP = addr.IP.String()
+		}
+		switch body := msg.Body.(type) {
+		case *icmp.Echo:
+			if (msg.Type == ipv4.ICMPTypeEchoReply || msg.Type == ipv6.ICMPTypeEchoReply) && body.Seq == seq && indexOfInt(ids, body.ID) >= 0 {
+				return peerIP, true, true
+			}
+		case *icmp.TimeExceeded:
+			if id, quoted := quotedEcho(body.Data, isIPv6); quoted == seq && indexOfInt(ids, id) >= 0 {
+				return peerIP, false, true
+			}
+		case *icmp.DstUnreach:
+			if id, quoted := quotedEcho(body.Data, isIPv6); quoted == seq && indexOfInt(ids, id) >= 0 {
+				return peerIP, true, true
+			}
+		}
+	}
+}
+
+// ID and seq of original echo in ICMP error, -1 if not found
+func quotedEcho(data []byte, isIPv6 bool) (int, int) {
+	headerLen := 40
+	if !isIPv6 {
+		if len(data) < 1 {
+			return -1, -1
+		}
+		headerLen = int(data[0]&0x0f) * 4
+	}
+	if len(data) < headerLen+8 {
+		return -1, -1
+	}
+	return int(binary.BigEndian.Uint16(data[headerLen+4 : headerLen+6])), int(binary.BigEndian.Uint16(data[headerLen+6 : headerLen+8]))
+}
+
+// Name and IPvX of server from menu index
+func tracerouteTarget(idx int, srv *serversInfo) (string, string, error) {
+	srv.L.RLock()
+	defer srv.L.RUnlock()
+	item, err := srv.byIndex(idx)
+	if err != nil {
+		return "", "", err
+	}
+	if !item.isIPv4 && !item.isIPv6 {
+		return "", "", fmt.Errorf("No addresses for %s", item.NAME)
+	}
+	return item.NAME, fillMask("{IPvX}", item), nil
+}
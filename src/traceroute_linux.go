@@ -0,0 +1,136 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const tracePort = 33434
+
+// Poll slice for checking of cancel
+const tracePollStep = time.Millisecond * 200
+
+// UDP traceroute with IP_RECVERR, doesn't need privileges. Only IPv4
+func tracerouteUnprivileged(ctx context.Context, dst net.IP, onHop func(*traceHop)) error {
+	dst4 := dst.To4()
+	if dst4 == nil {
+		return fmt.Errorf("Unprivileged traceroute supports only IPv4")
+	}
+	target := &unix.SockaddrInet4{}
+	copy(target.Addr[:], dst4)
+	probeNum := 0
+	for ttl := 1; ttl <= traceMaxHops; ttl++ {
+		hop := &traceHop{TTL: ttl}
+		for probe := 0; probe < traceProbes; probe++ {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			target.Port = tracePort + probeNum
+			probeNum++
+			peer, reached, rtt, err := traceUDPProbe(ctx, target, ttl)
+			if err != nil {
+				return err
+			}
+			if peer == "" {
+				hop.RTTs = append(hop.RTTs, -1)
+				continue
+			}
+			hop.RTTs = append(hop.RTTs, rtt)
+			hop.Addr = peer
+			hop.Reached = hop.Reached || reached
+		}
+		// last probe may be cut by cancel
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		onHop(hop)
+		if hop.Reached {
+			return nil
+		}
+	}
+	return nil
+}
+
+// Send one probe, return answered address or empty on timeout or cancel.
+// Socket is per probe, so errors are only for this probe
+func traceUDPProbe(ctx context.Context, target *unix.SockaddrInet4, ttl int) (string, bool, time.Duration, error) {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM, 0)
+	if err != nil {
+		return "", false, 0, err
+	}
+	defer unix.Close(fd)
+	if err = unix.SetsockoptInt(fd, unix.SOL_IP, unix.IP_RECVERR, 1); err != nil {
+		return "", false, 0, err
+	}
+	if err = unix.SetsockoptInt(fd, unix.SOL_IP, unix.IP_TTL, ttl); err != nil {
+		return "", false, 0, err
+	}
+	start := time.Now()
+	if err = unix.Sendto(fd, []byte(appName), 0, target); err != nil {
+		return "", false, 0, err
+	}
+	deadline := start.Add(traceTimeout)
+	buf := make([]byte, 512)
+	oob := make([]byte, 512)
+	for {
+		left := time.Until(deadline)
+		if left <= 0 || ctx.Err() != nil {
+			return "", false, 0, nil
+		}
+		if left > tracePollStep {
+			left = tracePollStep
+		}
+		fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLERR}}
+		if _, err = unix.Poll(fds, int(left/time.Millisecond)+1); err != nil && err != unix.EINTR {
+			return "", false, 0, err
+		}
+		if fds[0].Revents&unix.POLLERR == 0 {
+			continue
+		}
+		_, oobn, _, _, err := unix.Recvmsg(fd, buf, oob, unix.MSG_ERRQUEUE)
+		if err != nil {
+			continue
+		}
+		rtt := time.Since(start)
+		messages, err := unix.ParseSocketControlMessage(oob[:oobn])
+		if err != nil {
+			continue
+		}
+		for _, msg := range messages {
+			if msg.Header.Level != unix.SOL_IP || msg.Header.Type != unix.IP_RECVERR {
+				continue
+			}
+			if peer, reached, ok := parseExtendedErr(msg.Data); ok {
+				return peer, reached, rtt, nil
+			}
+		}
+	}
+}
+
+// struct sock_extended_err (16 bytes) and offender sockaddr_in after it
+func parseExtendedErr(data []byte) (string, bool, bool) {
+	if len(data) < 16+8 || data[4] != unix.SO_EE_ORIGIN_ICMP {
+		return "", false, false
+	}
+	icmpType, icmpCode := data[5], data[6]
+	if binary.LittleEndian.Uint16(data[16:18]) != unix.AF_INET && binary.BigEndian.Uint16(data[16:18]) != unix.AF_INET {
+		return "", false, false
+	}
+	peer := net.IPv4(data[20], data[21], data[22], data[23]).String()
+	// time exceeded - intermediate hop, port unreachable - target
+	switch icmpType {
+	case 11:
+		return peer, false, true
+	case 3:
+		return peer, icmpCode == 3 || icmpCode == 13 || icmpCode == 10 || icmpCode == 9, true
+	}
+	return "", false, false
+}
@@ -0,0 +1,25 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"context"
+	"net"
+
+	"golang.org/x/net/icmp"
+)
+
+// Traceroute over datagram ICMP socket, doesn't need privileges where supported
+func tracerouteUnprivileged(ctx context.Context, dst net.IP, onHop func(*traceHop)) error {
+	network := "udp4"
+	if dst.To4() == nil {
+		network = "udp6"
+	}
+	conn, err := icmp.ListenPacket(network, "")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return traceICMP(ctx, conn, dst, true, onHop)
+}
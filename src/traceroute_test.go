@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+func TestQuotedEcho(t *testing.T) {
+	echo := icmp.Message{Type: ipv4.ICMPTypeEcho, Body: &icmp.Echo{ID: 0x1234, Seq: 7, Data: []byte(appName)}}
+	data, err := echo.Marshal(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := make([]byte, 20)
+	header[0] = 0x45
+	if id, seq := quotedEcho(append(header, data...), false); id != 0x1234 || seq != 7 {
+		t.Errorf("quotedEcho IPv4 = %#x, %d", id, seq)
+	}
+	if id, seq := quotedEcho(append(make([]byte, 40), data...), true); id != 0x1234 || seq != 7 {
+		t.Errorf("quotedEcho IPv6 = %#x, %d", id, seq)
+	}
+	if id, seq := quotedEcho(header, false); id != -1 || seq != -1 {
+		t.Errorf("quotedEcho short = %d, %d", id, seq)
+	}
+}
+
+func TestTracerouteCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	err := traceroute(ctx, "192.0.2.1", func(*traceHop) {
+		t.Error("hop after cancel")
+	})
+	if err != context.Canceled {
+		t.Errorf("traceroute after cancel = %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("traceroute after cancel took %v", time.Since(start))
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -11,11 +12,14 @@ import (
 
 // UTF emoji
 const (
-	flagNL  = "\U0001F1F3\U0001F1F1" //Netherlands
-	flagFR  = "\U0001F1EB\U0001F1E7" //France
-	flagUG  = "\U0001F1FA\U0001F1EC" //Uganda
-	pingOK  = "\U00002705"
-	pingERR = "\U0000274C"
+	flagNL   = "\U0001F1F3\U0001F1F1" //Netherlands
+	flagFR   = "\U0001F1EB\U0001F1E7" //France
+	flagUG   = "\U0001F1FA\U0001F1EC" //Uganda
+	pingOK   = "\U00002705"
+	pingERR  = "\U0000274C"
+	pingDEG  = "\U0001F7E1"
+	checkUNK = "\U00002754"
+	warning  = "\U000026A0"
 )
 
 // Wait  - python-like thread.Wait
@@ -54,6 +58,25 @@ func (w *Wait) Set() {
 	w._isSet = true
 }
 
+// Position of value in list, -1 if not found
+func indexOf(list []string, value string) int {
+	for idx, item := range list {
+		if item == value {
+			return idx
+		}
+	}
+	return -1
+}
+
+func indexOfInt(list []int, value int) int {
+	for idx, item := range list {
+		if item == value {
+			return idx
+		}
+	}
+	return -1
+}
+
 func printErr(format string, a ...interface{}) {
 	format += "\n"
 	fmt.Fprintf(os.Stderr, format, a...)
@@ -63,45 +86,129 @@ func sReplaceAll(s, old, new string) string {
 	return strings.Replace(s, old, new, -1)
 }
 
+// Fill template for copy and probes
 func fillMask(mask string, data *serverInfo) string {
-	mask = sReplaceAll(mask, "{ID}", data.ID)
-	mask = sReplaceAll(mask, "{NAME}", data.NAME)
-	mask = sReplaceAll(mask, "{IPv4}", data.IPv4)
-	mask = sReplaceAll(mask, "{IPv6}", data.IPv6)
-	mask = sReplaceAll(mask, "{STATE}", data.STATE)
-	mask = sReplaceAll(mask, "{REGION}", data.REGION)
-	mask = sReplaceAll(mask, "{PING}", data.pingMS)
-	if data.isIPv4 {
-		mask = sReplaceAll(mask, "{IPvX}", data.IPv4)
+	return renderMask(mask, data, false, escapeNone)
+}
+
+// Fill template for copy action with escape mode
+func fillCopy(mask string, data *serverInfo, escapeMode string) (string, error) {
+	return executeMask(mask, data, false, escapeMode)
+}
+
+// Formats of values from settings
+type maskStyle struct {
+	duration string
+	symbols  *symbolSet
+}
+
+// Style applied by scaleway worker
+func activeMaskStyle() *maskStyle {
+	return &maskStyle{duration: getDurationFormat(), symbols: getSymbols()}
+}
+
+// Values of {KEY}, with symbols if view
+func maskValues(data *serverInfo, view bool, style *maskStyle) map[string]string {
+	result := map[string]string{
+		"ID":          data.ID,
+		"NAME":        data.NAME,
+		"HOSTNAME":    data.HOSTNAME,
+		"IPv4":        data.IPv4,
+		"IPv6":        data.IPv6,
+		"PRIVATE_IP":  data.private,
+		"STATE":       data.STATE,
+		"REGION":      data.REGION,
+		"PING":        data.pingMS,
+		"PING4":       data.pingMS4,
+		"PING6":       data.pingMS6,
+		"PING_MIN":    data.pingMin,
+		"PING_MAX":    data.pingMax,
+		"PING_AVG":    data.history.Avg(),
+		"PING_P95":    data.history.P95(),
+		"SPARK":       data.history.Spark(),
+		"LOSS":        data.loss,
+		"JITTER":      data.jitter,
+		"PORTS":       formatPorts(data.ports, emojiSymbols),
+		"HTTP":        data.httpState,
+		"HTTP_MS":     data.httpMS,
+		"CERT_DAYS":   data.certDays,
+		"CERT_ISSUER": data.certIssuer,
+		"DNS_OK":      data.dnsState,
+		"AGE":         formatSince(data.created, style.duration),
+		"MODIFIED":    formatSince(data.modified, style.duration),
+		"SINCE":       formatSince(data.stateSince, style.duration),
+		"IPvX":        "IPvX",
+	}
+	for key, value := range data.tagMap {
+		result["TAG:"+key] = value
+		result["HAS_TAG:"+key] = key
+	}
+	for name, check := range data.checks {
+		result["CHECK:"+name] = check.StatusName()
+		result["CHECK_OUT:"+name] = check.Output
+		result["CHECK_PERF:"+name] = check.Perf
+	}
+	if data.isIPv6 && data.useIPv6 {
+		result["IPvX"] = data.IPv6
+	} else if data.isIPv4 {
+		result["IPvX"] = data.IPv4
 	} else if data.isIPv6 {
-		mask = sReplaceAll(mask, "{IPvX}", data.IPv6)
-	} else {
-		mask = sReplaceAll(mask, "{IPvX}", "IPvX")
+		result["IPvX"] = data.IPv6
+	}
+	if !view {
+		return result
 	}
-	return mask
+	symbols := style.symbols
+	result["PORTS"] = formatPorts(data.ports, symbols)
+	result["HTTP"] = symbols.result(data.httpState)
+	result["DNS_OK"] = symbols.result(data.dnsState)
+	result["CERT_DAYS"] = symbols.result(data.certDays)
+	if data.certWarn {
+		result["CERT_DAYS"] = symbols.Warning + result["CERT_DAYS"]
+	}
+	for name, check := range data.checks {
+		result["CHECK:"+name] = symbols.check(check.Status)
+	}
+	result["FLAG"] = symbols.flag(data.REGION)
+	result["ALIVE"] = symbols.health(data.health.state)
+	result["ALIVE4"] = symbols.alive(data.isIPv4, data.pingState4)
+	result["ALIVE6"] = symbols.alive(data.isIPv6, data.pingState6)
+	result["STATE_ICON"] = symbols.state(data.STATE)
+	result["LATENCY_ICON"] = symbols.latency(data.pingState, data.pingMS)
+	return result
 }
 
-func fillView(mask string, data *serverInfo) string {
-	mask = fillMask(mask, data)
-	switch data.REGION {
-	case "par1":
-		mask = sReplaceAll(mask, "{FLAG}", flagFR)
-	case "ams1":
-		mask = sReplaceAll(mask, "{FLAG}", flagNL)
-	default:
-		mask = sReplaceAll(mask, "{FLAG}", flagUG)
-	}
-	if data.pingState {
-		mask = sReplaceAll(mask, "{ALIVE}", pingOK)
-	} else {
-		mask = sReplaceAll(mask, "{ALIVE}", pingERR)
+func formatPorts(ports []portState, symbols *symbolSet) string {
+	result := make([]string, len(ports))
+	for idx, port := range ports {
+		if port.Open {
+			result[idx] = strconv.Itoa(port.Port) + ":" + symbols.Up
+		} else {
+			result[idx] = strconv.Itoa(port.Port) + ":" + symbols.Down
+		}
 	}
-	return mask
+	return strings.Join(result, " ")
+}
+
+// Fill template for menu
+func fillView(mask string, data *serverInfo) string {
+	return renderMask(mask, data, true, escapeNone)
 }
 
-func writeToClipboard(idx int, cfg *settingsStorage, srv *serversInfo) (err error) {
+// Copy with action from server submenu, -1 for default action
+func writeToClipboard(idx, action int, cfg *settingsStorage, srv *serversInfo) (err error) {
 	cfg.L.RLock()
-	mask := cfg.D.CopyMask
+	if action < 0 {
+		action = cfg.D.defaultCopyAction()
+	}
+	if action < 0 || action >= len(cfg.D.CopyActions) {
+		cfg.L.RUnlock()
+		return fmt.Errorf("Wrong copy action: %d", action)
+	}
+	mask := cfg.D.CopyActions[action].Mask
+	escape := cfg.D.CopyActions[action].Escape
+	isDefault := action == cfg.D.defaultCopyAction()
+	rules := cfg.D.MaskRules
 	cfg.L.RUnlock()
 
 	srv.L.RLock()
@@ -113,7 +220,11 @@ func writeToClipboard(idx int, cfg *settingsStorage, srv *serversInfo) (err erro
 	} else {
 		id := srv.ServersList[idx]
 		if item, ok := srv.D[id]; ok {
-			err = clipboard.WriteAll(fillMask(mask, item))
+			var text string
+			copyMask, copyEscape := rules.CopyMask(mask, escape, isDefault, item)
+			if text, err = fillCopy(copyMask, item, copyEscape); err == nil {
+				err = clipboard.WriteAll(text)
+			}
 		} else {
 			panic(fmt.Errorf("serversInfo: Corrupted"))
 		}